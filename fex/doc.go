@@ -0,0 +1,56 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fex implements the field extraction language of fex(1) for use as
+// a library.
+//
+// An extract, such as "1" or `"2 /addr:/:-1`, is compiled into an Extractor
+// with CompileExtractor. An Extractor is a sequence of Selectors, each of which
+// tokenizes its input by a delimiter, selects some of the resulting fields
+// using a Filter, and joins the selected fields back together for the next
+// Selector in the sequence:
+//
+//	ex, err := fex.CompileExtractor(`"2 2`)
+//	if err != nil {
+//		return err
+//	}
+//	path, err := ex.Extract(`1.2.3.4 - - [...] "GET /index.html HTTP/1.1" 200`)
+//	// path == "/index.html"
+//
+// Selectors can also be built directly with NewSelector, using the Filters
+// (such as Group, FieldRange, and RegexpFilter) and SplitFuncs (such as
+// GreedySplit and NonGreedySplit) provided by this package or implemented by
+// the caller.
+//
+// The syntax accepted by CompileExtractor is documented in the fex(1) manual,
+// found in README.adoc at the root of this repository.
+//
+// # Compatibility
+//
+// This package follows semantic versioning, using the git tags of its module,
+// go.spiff.io/go-fex. From the first tagged release on, exported identifiers
+// will not be removed or changed in a way that breaks callers, and extracts
+// that compile successfully will continue to select the same fields.
+// New versions may add new selector syntax, but only using extracts that would
+// have previously failed to compile. A change that cannot keep this promise
+// will only be made in a new major version of the module.
+//
+// This promise does not cover versions of fex before the first tagged release.
+// A few extracts that compiled in those versions were given new meanings, as
+// listed under "Incompatible Changes" in the fex(1) manual.
+//
+// The command-line program in cmd/fex is built on this package. Its driver,
+// in internal/fex, is not part of the public API.
+package fex
@@ -0,0 +1,100 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorKind describes the kind of error found when parsing an extract.
+type ErrorKind string
+
+// Kinds of ParseError.
+const (
+	ErrUnexpectedRune ErrorKind = "unexpected character"
+	ErrUnmatchedBrace ErrorKind = "unmatched '}'"
+	ErrInvalidNumber  ErrorKind = "invalid field number"
+	ErrInvalidRange   ErrorKind = "invalid field range"
+	ErrInvalidRegexp  ErrorKind = "invalid regexp"
+	ErrEmptyDelimiter ErrorKind = "empty delimiter"
+	ErrUnknownFlag    ErrorKind = "unknown regexp flag"
+	ErrInvalidCapture ErrorKind = "invalid submatch reference"
+	ErrInvalidName    ErrorKind = "invalid column name"
+	ErrInvalidPath    ErrorKind = "invalid JSON path"
+	ErrInvalidKey     ErrorKind = "invalid key"
+	ErrTransform      ErrorKind = "invalid transform"
+)
+
+func (k ErrorKind) String() string {
+	return string(k)
+}
+
+// ParseError is returned by CompileExtractor, ParseGroup, and ParseFieldRange
+// when an extract cannot be parsed.
+type ParseError struct {
+	// Arg is the string being parsed.
+	Arg string
+	// Offset is the offset, in runes, of the error in Arg.
+	Offset int
+	// Selector is the index of the selector, starting at 0, that the error
+	// occurred in. If the index cannot be determined, it is -1.
+	Selector int
+	// Kind is the kind of error.
+	Kind ErrorKind
+	// Err is the underlying error, if any. It may be nil.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if e.Selector >= 0 {
+		fmt.Fprintf(&b, "selector %d, ", e.Selector+1)
+	}
+	fmt.Fprintf(&b, "character %d: %s", e.Offset+1, e.Kind)
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying error, if any.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Caret returns the argument of the error followed by a line with a caret
+// ('^') under the rune at the error's offset. Tabs are preserved on the caret
+// line so that it lines up with the argument.
+func (e *ParseError) Caret() string {
+	var b strings.Builder
+	b.WriteString(e.Arg)
+	b.WriteByte('\n')
+	i := 0
+	for _, r := range e.Arg {
+		if i >= e.Offset {
+			break
+		}
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+		i++
+	}
+	b.WriteByte('^')
+	return b.String()
+}
@@ -0,0 +1,194 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Extractor is a sequence of selectors, used to progressively select pieces of
+// text.
+type Extractor []Selector
+
+// Extract tokenizes and extracts fields from s, returning either a new string
+// or an error.
+func (e Extractor) Extract(s string) (result string, err error) {
+	result = s
+	for _, ex := range e {
+		result, err = ex.Extract(result)
+		if err != nil {
+			return "", err
+		}
+	}
+	return result, nil
+}
+
+// ExtractFields is like Extract, but fields, which have already been
+// tokenized, are passed to the first selector's filter instead of tokenizing
+// a string. zero is the string selected by the field index 0, such as the text
+// that fields were read from.
+func (e Extractor) ExtractFields(fields []string, zero string) (result string, err error) {
+	if len(e) == 0 {
+		return zero, nil
+	}
+	result, err = e[0].ExtractFields(fields, zero)
+	if err != nil {
+		return "", err
+	}
+	return e[1:].Extract(result)
+}
+
+// Resolve returns a copy of the extractor with the column names in its first
+// selector replaced by the indices of the columns in header, which is usually
+// the first record of input split by the first selector's Split method. Only
+// the first selector may refer to columns by name. If header is nil, Resolve
+// returns an error wrapping ErrNoHeader if the first selector refers to any
+// columns by name.
+func (e Extractor) Resolve(header []string) (Extractor, error) {
+	resolved := make(Extractor, len(e))
+	copy(resolved, e)
+	for i := range resolved {
+		sel := &resolved[i]
+		r, ok := sel.filter.(Resolver)
+		if !ok {
+			continue
+		}
+
+		var err error
+		if i == 0 {
+			sel.filter, err = r.Resolve(header)
+		} else if sel.filter, err = r.Resolve(nil); errors.Is(err, ErrNoHeader) {
+			err = fmt.Errorf("selector %d: column names can only be used in the first selector", i+1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// Selector is an individual part of an extraction string, such as "N",
+// "_{?N:M}", or " /Rx/".  A selector tokenizes a string, filters the tokens,
+// and returns a new string based on its delimiter.
+//
+// The zero Selector returns its input unchanged, as with the field index 0.
+type Selector struct {
+	delim    string
+	join     string
+	tokenize SplitFunc
+	filter   Filter
+}
+
+// NewSelector returns a Selector that tokenizes strings with tokenize, using
+// delim as its delimiter, selects fields with filter, and joins the selected
+// fields with delim. The string used to join fields can be changed with
+// WithJoin.
+//
+// If tokenize is nil, GreedySplit is used. If filter is nil, the Selector
+// returns its input unchanged, as with the field index 0.
+func NewSelector(delim string, tokenize SplitFunc, filter Filter) Selector {
+	if tokenize == nil {
+		tokenize = GreedySplit
+	}
+	if filter == nil {
+		filter = FieldRange{}
+	}
+	return Selector{
+		delim:    delim,
+		join:     delim,
+		tokenize: tokenize,
+		filter:   filter,
+	}
+}
+
+// WithJoin returns a copy of the selector that joins selected fields with join
+// instead of its delimiter.
+func (sel Selector) WithJoin(join string) Selector {
+	sel.join = join
+	return sel
+}
+
+// Delim returns the selector's delimiter.
+func (sel *Selector) Delim() string {
+	return sel.delim
+}
+
+// Join returns the string used to join selected fields.
+func (sel *Selector) Join() string {
+	return sel.join
+}
+
+// Filter returns the Filter used by the selector to select fields.
+func (sel *Selector) Filter() Filter {
+	if sel.filter == nil {
+		return FieldRange{}
+	}
+	return sel.filter
+}
+
+// Split tokenizes s into the fields passed to the selector's filter.
+func (sel *Selector) Split(s string) []string {
+	if sel.tokenize == nil {
+		return GreedySplit(sel.delim, s)
+	}
+	return sel.tokenize(sel.delim, s)
+}
+
+// Extract tokenizes s, selects fields from the tokens, and returns the selected
+// fields joined by the selector's join string.
+func (sel *Selector) Extract(s string) (string, error) {
+	return sel.ExtractFields(sel.Split(s), s)
+}
+
+// ExtractFields selects fields, which have already been tokenized, and returns
+// them joined by the selector's join string. zero is the string selected by the
+// field index 0.
+func (sel *Selector) ExtractFields(fields []string, zero string) (string, error) {
+	fields, err := sel.Filter().Select(fields, zero)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(fields, sel.join), nil
+}
+
+// Utility functions
+
+// abs returns an offset relative to a range [1, length].
+// Negative rel values are offsets from the end of a sequence, going down.
+// Positive (including zero) rel values are offsets from the start of
+// a sequence, going up. The result is not bounds-checked.
+func abs(rel, length int) int {
+	if rel < 0 {
+		rel = length + 1 + rel
+	}
+	return rel
+}
+
+func reverseStrings(s []string) {
+	for j := len(s)/2 - 1; j >= 0; j-- {
+		opp := len(s) - 1 - j
+		s[j], s[opp] = s[opp], s[j]
+	}
+}
+
+func reverseInts(s []int) {
+	for j := len(s)/2 - 1; j >= 0; j-- {
+		opp := len(s) - 1 - j
+		s[j], s[opp] = s[opp], s[j]
+	}
+}
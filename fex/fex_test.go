@@ -0,0 +1,585 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// ExtractCase is a single extract applied to an input string.
+type ExtractCase struct {
+	Arg   string
+	Input string
+	Want  string
+}
+
+func (tc *ExtractCase) Run(t *testing.T) {
+	ex, err := CompileExtractor(tc.Arg)
+	if err != nil {
+		t.Fatalf("CompileExtractor(%q) = %v", tc.Arg, err)
+	}
+	got, err := ex.Extract(tc.Input)
+	if err != nil {
+		t.Fatalf("Extract(%q) = %v", tc.Input, err)
+	}
+	if got != tc.Want {
+		t.Errorf("Extract(%q) = %q; want %q", tc.Input, got, tc.Want)
+	}
+}
+
+// extractCases run by TestExtract. Most selector behavior is covered by the
+// command's tests in internal/fex.
+var extractCases = map[string]*ExtractCase{
+	"Field": &ExtractCase{
+		Arg:   `3`,
+		Input: `a b c d e`,
+		Want:  `c`,
+	},
+
+	"Chained": &ExtractCase{
+		Arg:   `"2 /addr:/:-1`,
+		Input: `x "y addr:10.1.0.24 z" w`,
+		Want:  `10.1.0.24`,
+	},
+}
+
+func TestExtract(t *testing.T) {
+	for name, tc := range extractCases {
+		tc := tc
+		t.Run(name, tc.Run)
+	}
+}
+
+func TestCompileExtractorDelim(t *testing.T) {
+	const input = "a b\nc:d e\nf"
+	cases := map[string]string{
+		`2`:    "c:d e",
+		`2 2`:  "e",
+		`2:1`:  "c",
+		`-1`:   "f",
+		`:1`:   "a b\nc",
+		`#{1}`: "a",
+	}
+	for arg, want := range cases {
+		ex, err := CompileExtractorDelim(arg, "\n")
+		if err != nil {
+			t.Errorf("CompileExtractorDelim(%q) = %v", arg, err)
+			continue
+		}
+		if got, err := ex.Extract(input); err != nil || got != want {
+			t.Errorf("Extract(%q) = %q, %v; want %q", arg, got, err, want)
+		}
+	}
+}
+
+func TestNewSelector(t *testing.T) {
+	rx, err := NewRegexpFilter(`^b`)
+	if err != nil {
+		t.Fatalf("NewRegexpFilter(...) = %v", err)
+	}
+
+	ex := Extractor{
+		NewSelector(":", NonGreedySplit, Group{{Start: 2, End: -1}}),
+		NewSelector(":", nil, rx),
+		NewSelector("", nil, nil),
+	}
+	const (
+		input = "foo::bar:baz:bop"
+		want  = "bar:baz:bop"
+	)
+	if got, err := ex.Extract(input); err != nil {
+		t.Errorf("Extract(%q) = %v", input, err)
+	} else if got != want {
+		t.Errorf("Extract(%q) = %q; want %q", input, got, want)
+	}
+
+	if got := ex[0].Delim(); got != ":" {
+		t.Errorf("Delim() = %q; want %q", got, ":")
+	}
+	if got, ok := ex[2].Filter().(FieldRange); !ok || got != (FieldRange{}) {
+		t.Errorf("Filter() = %#v; want FieldRange{}", ex[2].Filter())
+	}
+
+	var zero Selector
+	if got, err := zero.Extract(input); err != nil || got != input {
+		t.Errorf("Selector{}.Extract(%q) = %q, %v; want %q", input, got, err, input)
+	}
+}
+
+func TestExtractFields(t *testing.T) {
+	ex := MustCompileExtractor(`,{3,1} -1`)
+	fields := []string{"a b", "c", "d e"}
+	if got, err := ex.ExtractFields(fields, ""); err != nil || got != "b" {
+		t.Errorf("ExtractFields(%q) = %q, %v; want %q", fields, got, err, "b")
+	}
+	if got, err := ex[:1].ExtractFields(fields, ""); err != nil || got != "d e,a b" {
+		t.Errorf("ExtractFields(%q) = %q, %v; want %q", fields, got, err, "d e,a b")
+	}
+	if got, err := MustCompileExtractor(`0`).ExtractFields(fields, "zero"); err != nil || got != "zero" {
+		t.Errorf("ExtractFields(%q) = %q, %v; want %q", fields, got, err, "zero")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	header := []string{"PID", "USER", "%CPU", "COMMAND", "X", "X"}
+	ex := MustCompileExtractor(`{%CPU,PID} 1`)
+	resolved, err := ex.Resolve(header)
+	if err != nil {
+		t.Fatalf("Resolve(%q) = %v", header, err)
+	}
+	fields := []string{"1", "root", "0.5 %", "init", "", ""}
+	if got, err := resolved.ExtractFields(fields, ""); err != nil || got != "0.5" {
+		t.Errorf("ExtractFields(%q) = %q, %v; want %q", fields, got, err, "0.5")
+	}
+	if _, err := ex.ExtractFields(fields, ""); !errors.Is(err, ErrNoHeader) {
+		t.Errorf("ExtractFields(%q) = %v; want ErrNoHeader", fields, err)
+	}
+	for _, c := range []Complement{
+		{Of: Group{{StartName: "X", EndName: "X"}}},
+		{Of: FieldRange{Start: 1, EndName: "USER"}},
+	} {
+		if got, err := c.Select(fields, ""); !errors.Is(err, ErrNoHeader) {
+			t.Errorf("%#v.Select(%q) = %q, %v; want ErrNoHeader", c, fields, got, err)
+		}
+	}
+
+	cases := []struct {
+		Arg  string
+		Want string
+	}{
+		{`{USER:@%CPU}`, "root 0.5 %"},
+		{`{<@USER:COMMAND:2}`, "init root"},
+		{`{!:USER}`, "0.5 % init  "},
+	}
+	for _, c := range cases {
+		ex, err := MustCompileExtractor(c.Arg).Resolve(header)
+		if err != nil {
+			t.Errorf("Resolve(%q) for %q = %v", header, c.Arg, err)
+		} else if got, err := ex.ExtractFields(fields, ""); err != nil || got != c.Want {
+			t.Errorf("ExtractFields(%q) for %q = %q, %v; want %q", fields, c.Arg, got, err, c.Want)
+		}
+	}
+
+	for _, arg := range []string{`{TIME}`, `{X}`, `{!1,TIME}`, `1:{PID}`, `{COMMAND:USER}`, `{USER:0}`} {
+		if _, err := MustCompileExtractor(arg).Resolve(header); err == nil {
+			t.Errorf("Resolve(%q) for %q = nil; want error", header, arg)
+		}
+	}
+	if _, err := MustCompileExtractor(`{!PID}`).Resolve(nil); !errors.Is(err, ErrNoHeader) {
+		t.Errorf("Resolve(nil) = %v; want ErrNoHeader", err)
+	}
+}
+
+func TestRegexpSplit(t *testing.T) {
+	const input = "a, b;;c"
+	rx := regexp.MustCompile(`[,;]\s*`)
+	if got, want := GreedyRegexpSplit(rx)("", input), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GreedyRegexpSplit(%q) = %q; want %q", input, got, want)
+	}
+	if got, want := NonGreedyRegexpSplit(rx)("", input), []string{"a", "b", "", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NonGreedyRegexpSplit(%q) = %q; want %q", input, got, want)
+	}
+
+	sel := NewSelector(rx.String(), GreedyRegexpSplit(rx), Group{{Start: 1, End: 1}, {Start: 3, End: 3}}).WithJoin("+")
+	if got, err := sel.Extract(input); err != nil || got != "a+c" {
+		t.Errorf("Extract(%q) = %q, %v; want %q", input, got, err, "a+c")
+	}
+}
+
+func TestQuotedSplit(t *testing.T) {
+	const input = `a  "b c"\ d 'e\' ""`
+	cases := []struct {
+		Greedy, Unquote bool
+		Want            []string
+	}{
+		{true, false, []string{"a", `"b c"\ d`, `'e\'`, `""`}},
+		{true, true, []string{"a", "b c d", `e\`, ""}},
+		{false, false, []string{"a", "", `"b c"\ d`, `'e\'`, `""`}},
+	}
+	for _, c := range cases {
+		got := QuotedSplit(c.Greedy, c.Unquote)(" ", input)
+		if !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("QuotedSplit(%t, %t)(%q) = %q; want %q", c.Greedy, c.Unquote, input, got, c.Want)
+		}
+	}
+}
+
+func TestInferColumns(t *testing.T) {
+	const header = "  PID NAME     DESC   ZONE"
+	sample := []string{
+		"    1 init     a b c  UTC",
+		"12345 longname d      ",
+		"",
+	}
+	want := Columns{5, 14, 21}
+	cols := InferColumns(header, sample)
+	if !reflect.DeepEqual(cols, want) {
+		t.Fatalf("InferColumns(%q, %q) = %v; want %v", header, sample, cols, want)
+	}
+
+	for _, c := range []struct {
+		Line string
+		Want []string
+	}{
+		{sample[0], []string{"1", "init", "a b c", "UTC"}},
+		{sample[1], []string{"12345", "longname", "d", ""}},
+		{"", []string{"", "", "", ""}},
+		{"123456789abcdefghijklmnopqrstuvwxyz", []string{"12345", "6789abcde", "fghijkl", "mnopqrstuvwxyz"}},
+	} {
+		if got := cols.Split("", c.Line); !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("Split(%q) = %q; want %q", c.Line, got, c.Want)
+		}
+	}
+
+	// Mount points that don't reach past "Mounted" leave "on" blank
+	const df = "Filesystem     1K-blocks    Used Available Use% Mounted on"
+	dfSample := []string{
+		"/dev/sda1       41152736 9123456  29917704  24% /",
+		"/dev/sdb1        1024000    2048   1021952   1% /",
+	}
+	line := dfSample[0]
+	wantFields := []string{"/dev/sda1", "41152736", "9123456", "29917704", "24%", "/"}
+	if got := InferColumns(df, dfSample).Split("", line); !reflect.DeepEqual(got, wantFields) {
+		t.Errorf("InferColumns(%q, %q).Split(%q) = %q; want %q", df, dfSample, line, got, wantFields)
+	}
+}
+
+func TestJSONFilter(t *testing.T) {
+	const input = `{"a":{"b":[1,"two",{"c":null}]},"d e":true}`
+	cases := []struct {
+		Paths string
+		Want  []string
+	}{
+		{`.a.b[0]`, []string{"1"}},
+		{`.a.b[-1].c,.a.b[1]`, []string{"null", "two"}},
+		{`["d e"],.a.x,.a.b[3],.a.b[-4]`, []string{"true"}},
+		{`.a.b[*]`, []string{"1", "two", `{"c":null}`}},
+		{`.*`, []string{`{"b":[1,"two",{"c":null}]}`, "true"}},
+		{`.a.b.c,.a[0]`, nil},
+	}
+	for _, c := range cases {
+		f, err := ParseJSONFilter(c.Paths)
+		if err != nil {
+			t.Errorf("ParseJSONFilter(%q) = %v", c.Paths, err)
+			continue
+		}
+		got, err := f.Select([]string{input}, "")
+		if err != nil || !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("Select(%q) with %q = %q, %v; want %q", input, c.Paths, got, err, c.Want)
+		}
+	}
+
+	f, _ := ParseJSONFilter(`.`)
+	for _, bad := range []string{``, `{`, `{} {}`} {
+		if _, err := f.Select([]string{bad}, ""); err == nil {
+			t.Errorf("Select(%q) = nil; want error", bad)
+		}
+	}
+	for _, bad := range []string{``, `a`, `.a..b`, `.a[`, `.a[1`, `["a"`, `[x]`, `.a,`, `.a|b`} {
+		if _, err := ParseJSONFilter(bad); err == nil {
+			t.Errorf("ParseJSONFilter(%q) = nil; want error", bad)
+		}
+	}
+}
+
+func TestKeyValueFilter(t *testing.T) {
+	fields := []string{`a=1`, `b="x \"y\""`, `c='p q'`, `d`, `a==2`}
+	cases := []struct {
+		Keys []string
+		Want []string
+	}{
+		{[]string{"a"}, []string{"1", "=2"}},
+		{[]string{"c", "b", "x"}, []string{"p q", `x "y"`}},
+		{[]string{"d"}, []string{""}},
+	}
+	for _, c := range cases {
+		got, err := NewKeyValueFilter("=", c.Keys...).Select(fields, "")
+		if err != nil || !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("Select(%q) with keys %q = %q, %v; want %q", fields, c.Keys, got, err, c.Want)
+		}
+	}
+}
+
+func TestTransformFilter(t *testing.T) {
+	fields := []string{" Ab ", "xYz"}
+	cases := []struct {
+		Name string
+		Args []string
+		Want []string
+	}{
+		{"upper", nil, []string{" AB ", "XYZ"}},
+		{"lower", nil, []string{" ab ", "xyz"}},
+		{"trim", nil, []string{"Ab", "xYz"}},
+		{"trim", []string{" xz"}, []string{"Ab", "Y"}},
+		{"length", nil, []string{"4", "3"}},
+		{"pad", []string{"5"}, []string{"  Ab ", "  xYz"}},
+		{"pad", []string{"-5", "é"}, []string{" Ab é", "xYzéé"}},
+		{"pad", []string{"2"}, []string{" Ab ", "xYz"}},
+	}
+	for _, c := range cases {
+		tf, err := NewTransformFilter(c.Name, c.Args...)
+		if err != nil {
+			t.Errorf("NewTransformFilter(%q, %q) = %v", c.Name, c.Args, err)
+			continue
+		}
+		if got, err := tf.Select(fields, ""); err != nil || !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("%s(%q).Select(%q) = %q, %v; want %q", c.Name, c.Args, fields, got, err, c.Want)
+		}
+	}
+
+	for _, c := range []struct {
+		Name string
+		Args []string
+	}{
+		{"nope", nil},
+		{"upper", []string{"x"}},
+		{"trim", []string{"a", "b"}},
+		{"pad", nil},
+		{"pad", []string{"1.5"}},
+	} {
+		if _, err := NewTransformFilter(c.Name, c.Args...); err == nil {
+			t.Errorf("NewTransformFilter(%q, %q) = nil; want error", c.Name, c.Args)
+		}
+	}
+}
+
+func TestTimeTransform(t *testing.T) {
+	cases := []struct {
+		Args  []string
+		Input string
+		Want  string
+	}{
+		{[]string{"apache"}, "10/Oct/2026:13:55:36 -0700", "2026-10-10T13:55:36-07:00"},
+		{[]string{"apache", "unix"}, " 10/Oct/2026:13:55:36 -0700 ", "1791665736"},
+		{[]string{"rfc3339", "unixms"}, "2026-10-10T20:55:36.5Z", "1791665736500"},
+		{[]string{"unix", "rfc3339", "UTC"}, "1791665736", "2026-10-10T20:55:36Z"},
+		{[]string{"unix", "2006-01-02 15:04:05.000"}, "-1.25", "1969-12-31 23:59:58.750"},
+		{[]string{"unixms", "apache"}, "1791665736500", "10/Oct/2026:20:55:36 +0000"},
+		{[]string{"2006-01-02 15:04", "rfc3339", "UTC"}, "2026-10-10 08:30", "2026-10-10T08:30:00Z"},
+		{[]string{"rfc3339", "", "UTC"}, "2026-10-10T13:55:36-07:00", "2026-10-10T20:55:36Z"},
+	}
+	for _, c := range cases {
+		tf, err := NewTransformFilter("time", c.Args...)
+		if err != nil {
+			t.Errorf("NewTransformFilter(%q, %q) = %v", "time", c.Args, err)
+			continue
+		}
+		got, err := tf.Select([]string{c.Input}, "")
+		if err != nil || len(got) != 1 || got[0] != c.Want {
+			t.Errorf("time(%q).Select(%q) = %q, %v; want %q", c.Args, c.Input, got, err, c.Want)
+		}
+	}
+
+	for _, c := range []struct {
+		Args  []string
+		Input string
+	}{
+		{[]string{"unix"}, "1.x"},
+		{[]string{"unix"}, "x.5"},
+		{[]string{"unixms"}, "1.5"},
+		{[]string{"apache"}, "2026-10-10T13:55:36Z"},
+	} {
+		tf, err := NewTransformFilter("time", c.Args...)
+		if err != nil {
+			t.Errorf("NewTransformFilter(%q, %q) = %v", "time", c.Args, err)
+		} else if got, err := tf.Select([]string{c.Input}, ""); err == nil {
+			t.Errorf("time(%q).Select(%q) = %q; want error", c.Args, c.Input, got)
+		}
+	}
+
+	if _, err := NewTransformFilter("time", "unix", "unix", "Nowhere/Nothing"); err == nil {
+		t.Error("NewTransformFilter with an unknown time zone = nil; want error")
+	}
+}
+
+func TestCodecTransforms(t *testing.T) {
+	cases := []struct {
+		Name, Codec string
+		Input, Want string
+	}{
+		{"decode", "url", "/a%20b+c/%C3%A9", "/a b+c/é"},
+		{"encode", "url", "a b/c", "a%20b%2Fc"},
+		{"decode", "query", "q=a+b%26c", "q=a b&c"},
+		{"encode", "query", "a b&c", "a+b%26c"},
+		{"decode", "base64", "aGk/Pz8=", "hi???"},
+		{"decode", "base64", "aGk/Pz8", "hi???"},
+		{"encode", "base64", "hi???", "aGk/Pz8="},
+		{"decode", "base64url", "aGk_Pz8", "hi???"},
+		{"encode", "base64url", "hi???", "aGk_Pz8="},
+		{"decode", "hex", "6869FF", "hi\xff"},
+		{"encode", "hex", "hi\xff", "6869ff"},
+		{"decode", "json", `a\"b\n\u00e9`, "a\"b\né"},
+		{"decode", "json", `"a\tb"`, "a\tb"},
+		{"encode", "json", "<a\"b>\n", `<a\"b>\n`},
+		{"decode", "html", "&lt;a&gt; &amp;amp; &#39;", "<a> &amp; '"},
+		{"encode", "html", "<a href='x'>", "&lt;a href=&#39;x&#39;&gt;"},
+	}
+	for _, c := range cases {
+		tf, err := NewTransformFilter(c.Name, c.Codec)
+		if err != nil {
+			t.Errorf("NewTransformFilter(%q, %q) = %v", c.Name, c.Codec, err)
+			continue
+		}
+		got, err := tf.Select([]string{c.Input}, "")
+		if err != nil || len(got) != 1 || got[0] != c.Want {
+			t.Errorf("%s(%s).Select(%q) = %q, %v; want %q", c.Name, c.Codec, c.Input, got, err, c.Want)
+		}
+	}
+
+	for _, c := range []struct{ Codec, Input string }{
+		{"url", "%zz"},
+		{"base64", "a!"},
+		{"base64url", "aGk/Pz8"},
+		{"hex", "abc"},
+		{"json", `a\x`},
+	} {
+		tf, err := NewTransformFilter("decode", c.Codec)
+		if err != nil {
+			t.Errorf("NewTransformFilter(%q, %q) = %v", "decode", c.Codec, err)
+		} else if got, err := tf.Select([]string{c.Input}, ""); err == nil {
+			t.Errorf("decode(%s).Select(%q) = %q; want error", c.Codec, c.Input, got)
+		}
+	}
+
+	if _, err := NewTransformFilter("decode", "rot13"); err == nil {
+		t.Error("NewTransformFilter with an unknown encoding = nil; want error")
+	}
+}
+
+func TestTransformErrorPolicy(t *testing.T) {
+	fields := []string{"6869", "x", "21"}
+	cases := []struct {
+		Arg    string
+		Policy ErrorPolicy
+		Want   []string
+	}{
+		{"", FailOnError, nil},
+		{"onerror=fail", FailOnError, nil},
+		{"onerror=keep", KeepOnError, []string{"hi", "x", "!"}},
+		{"onerror=empty", EmptyOnError, []string{"hi", "", "!"}},
+	}
+	for _, c := range cases {
+		args := []string{"hex"}
+		if c.Arg != "" {
+			args = append(args, c.Arg)
+		}
+		tf, err := NewTransformFilter("decode", args...)
+		if err != nil {
+			t.Errorf("NewTransformFilter(%q, %q) = %v", "decode", args, err)
+			continue
+		}
+		if got := tf.Policy(); got != c.Policy {
+			t.Errorf("decode(%q).Policy() = %q; want %q", args, got, c.Policy)
+		}
+		if got := tf.Args(); !reflect.DeepEqual(got, []string{"hex"}) {
+			t.Errorf("decode(%q).Args() = %q; want %q", args, got, []string{"hex"})
+		}
+		got, err := tf.Select(fields, "")
+		if c.Want == nil {
+			if err == nil {
+				t.Errorf("decode(%q).Select(%q) = %q; want error", args, fields, got)
+			}
+		} else if err != nil || !reflect.DeepEqual(got, c.Want) {
+			t.Errorf("decode(%q).Select(%q) = %q, %v; want %q", args, fields, got, err, c.Want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"hex", "onerror=skip"},
+		{"onerror=keep"},
+		{"onerror=keep", "hex"},
+	} {
+		if _, err := NewTransformFilter("decode", args...); err == nil {
+			t.Errorf("NewTransformFilter(%q, %q) = nil; want error", "decode", args)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	cases := map[string]string{
+		``:          ``,
+		`a b`:       `a b`,
+		`\t`:        "\t",
+		`;\n`:       ";\n",
+		`\z\e`:      "\x00\x1b",
+		`\\ \x`:     `\ x`,
+		`trailing\`: `trailing\`,
+	}
+	for in, want := range cases {
+		if got := Unescape(in); got != want {
+			t.Errorf("Unescape(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+func TestMustCompileExtractor(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustCompileExtractor did not panic")
+		}
+	}()
+	MustCompileExtractor(`1}`)
+}
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		Arg      string
+		Offset   int
+		Selector int
+		Kind     ErrorKind
+	}{
+		{`{1,3:1}`, 3, 0, ErrInvalidRange},
+		{`1:{1x}`, 3, 1, ErrInvalidNumber},
+		{`{a,@:b}`, 3, 0, ErrInvalidName},
+		{`1 =:{a,,b}`, 7, 1, ErrInvalidKey},
+		{`1 /(/ 2`, 3, 1, ErrInvalidRegexp},
+		{`1 2}`, 3, 2, ErrUnmatchedBrace},
+		{`1 x`, 2, 1, ErrUnexpectedRune},
+		{`1 2 3 ~`, 6, 3, ErrUnexpectedRune},
+		{`age`, 2, 0, ErrUnexpectedRune},
+		{`1'ab'x`, 5, 1, ErrUnexpectedRune},
+		{`@.ipv4`, 4, 1, ErrInvalidPath},
+		{`@.a.b2`, 4, 1, ErrInvalidPath},
+		{`1|lower|nope(1)`, 8, 2, ErrTransform},
+		{`1|trim(',x)`, 7, 1, ErrTransform},
+	}
+
+	for _, c := range cases {
+		_, err := CompileExtractor(c.Arg)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("CompileExtractor(%q) = %v; want *ParseError", c.Arg, err)
+			continue
+		}
+		if pe.Arg != c.Arg || pe.Offset != c.Offset || pe.Selector != c.Selector || pe.Kind != c.Kind {
+			t.Errorf("CompileExtractor(%q) = %#v; want offset %d, selector %d, kind %q",
+				c.Arg, pe, c.Offset, c.Selector, c.Kind)
+		}
+	}
+
+	_, rangeErr := ParseFieldRange(`3:1`)
+	_, groupErr := ParseGroup(`1,0:2`)
+	for _, err := range []error{rangeErr, groupErr} {
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Selector != -1 || strings.Contains(pe.Error(), "selector") {
+			t.Errorf("ParseError = %#v; want selector -1", err)
+		}
+	}
+}
@@ -0,0 +1,645 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Filter selects a subset of fields plus the zero string to extract from the
+// input. For selectors that can return the original string, the zero string is
+// provided.
+type Filter interface {
+	Select(fields []string, zero string) ([]string, error)
+}
+
+// Indexer is implemented by Filters that can report the indices of the fields
+// they select. Indices start at 0 and may be repeated.
+type Indexer interface {
+	Indices(fields []string) []int
+}
+
+// Resolver is implemented by Filters that can refer to fields by the names of
+// columns in a header, such as a Group. Resolve returns a copy of the Filter
+// that refers to the named columns by their indices in header. If header is
+// nil and the Filter refers to a column by name, the error wraps ErrNoHeader.
+type Resolver interface {
+	Resolve(header []string) (Filter, error)
+}
+
+// ErrNoHeader is wrapped by errors from Resolve and Select when a column is
+// referred to by name without a header.
+var ErrNoHeader = errors.New("no header")
+
+// Complement is a Filter that selects the fields not selected by its Indexer,
+// in their original order.
+type Complement struct {
+	Of Indexer
+}
+
+// namedIndexer is an Indexer that can refer to fields by column name, such as
+// a Group or FieldRange.
+type namedIndexer interface {
+	Indexer
+	Resolver
+	hasNames() bool
+}
+
+// Select returns the fields whose indices are not returned by c.Of. Like
+// Group, it's an error if c.Of refers to columns by name that have not been
+// resolved.
+func (c Complement) Select(fields []string, _ string) ([]string, error) {
+	if n, ok := c.Of.(namedIndexer); ok && n.hasNames() {
+		_, err := n.Resolve(nil)
+		return nil, err
+	}
+	excluded := make([]bool, len(fields))
+	for _, i := range c.Of.Indices(fields) {
+		excluded[i] = true
+	}
+	fs := make([]string, 0, len(fields))
+	for i, f := range fields {
+		if !excluded[i] {
+			fs = append(fs, f)
+		}
+	}
+	return fs, nil
+}
+
+// Resolve resolves column names in c.Of, if it is a Resolver.
+func (c Complement) Resolve(header []string) (Filter, error) {
+	r, ok := c.Of.(Resolver)
+	if !ok {
+		return c, nil
+	}
+	f, err := r.Resolve(header)
+	if err != nil {
+		return nil, err
+	}
+	of, ok := f.(Indexer)
+	if !ok {
+		return nil, fmt.Errorf("resolved %T is not an Indexer", f)
+	}
+	return Complement{Of: of}, nil
+}
+
+// Group is a collection of field ranges, such as {1} or {1,4:5} or {-2:-1}.
+// It is not responsible for distinguishing between greedy and non-greedy
+// groupings.
+type Group []FieldRange
+
+// Select returns the fields selected by each FieldRange in the group, in
+// order.
+func (g Group) Select(fields []string, zero string) ([]string, error) {
+	fs := make([]string, 0, 4)
+	for _, fr := range g {
+		selected, err := fr.Select(fields, zero)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, selected...)
+	}
+	return fs, nil
+}
+
+// Indices returns the indices of the fields selected by each FieldRange in the
+// group.
+func (g Group) Indices(fields []string) []int {
+	idx := make([]int, 0, 4)
+	for _, fr := range g {
+		idx = append(idx, fr.Indices(fields)...)
+	}
+	return idx
+}
+
+// Resolve returns a copy of the group with the column names of its field
+// ranges replaced by the indices of the columns in header.
+func (g Group) Resolve(header []string) (Filter, error) {
+	resolved := make(Group, len(g))
+	for i, fr := range g {
+		var err error
+		if resolved[i], err = fr.resolve(header); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// hasNames returns whether any of the group's field ranges use column names.
+func (g Group) hasNames() bool {
+	for _, fr := range g {
+		if fr.hasNames() {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGroup parses a comma-separated list of field ranges, such as "1,4:5" or
+// "<-2:-1", as found between the braces of a group selector. If s cannot be
+// parsed, the error is a *ParseError.
+func ParseGroup(s string) (Group, error) {
+	specs := strings.Split(s, ",")
+	g := make(Group, len(specs))
+	off := 0
+	for i, spec := range specs {
+		fr, err := ParseFieldRange(spec)
+		if err != nil {
+			pe := err.(*ParseError)
+			pe.Arg, pe.Offset = s, off+pe.Offset
+			return nil, pe
+		}
+		g[i] = fr
+		off += utf8.RuneCountInString(spec) + 1
+	}
+	return g, nil
+}
+
+// FieldRange is an inclusive range of [Start, End], where indices at Start
+// begin with 1.  A FieldRange with a negative start or end (or both) is
+// considered relative, and cannot be considered valid until an absolute
+// FieldRange has been created using abs.
+//
+// The empty FieldRange refers to {0:0}, {0}, or just 0 as a field index
+// (meaning the original string).
+//
+// Step selects every Step'th field in the range. A negative Step walks the
+// range from End to Start instead. A Step of 0 is the same as 1. If Reverse is
+// set, the stepped fields are reversed.
+//
+// If StartName or EndName is set, Start or End is instead the index of the
+// column with that name in a header, and the FieldRange must be resolved with
+// Resolve before it can select fields.
+type FieldRange struct {
+	Start   int
+	End     int
+	Step    int
+	Reverse bool
+
+	StartName string
+	EndName   string
+}
+
+// ParseFieldRange parses a single field index or range, such as "1", "-2:",
+// "<1:3", or "2::3". If s cannot be parsed, the error is a *ParseError.
+//
+// The start and end of the range may also be column names, such as "PID" or
+// "USER:TIME". A name that starts with a digit, sign, or '@' must be written
+// with an '@' prefix, as in "@1st", which is removed from the name.
+func ParseFieldRange(s string) (FieldRange, error) {
+	const reversePrefix = "<"
+
+	var (
+		arg     = s
+		reverse = strings.HasPrefix(s, reversePrefix)
+		off     = 0
+	)
+	if reverse {
+		s = s[len(reversePrefix):]
+		off = len(reversePrefix)
+	}
+
+	n := strings.IndexByte(s, ':')
+	if n == -1 {
+		i, name, err := parseEndpoint(arg, s, off)
+		if err != nil {
+			return FieldRange{}, err
+		}
+		return FieldRange{Start: i, End: i, StartName: name, EndName: name}, nil
+	}
+
+	var (
+		start, end = s[:n], s[n+1:]
+		step       string
+		err        error
+		f          = FieldRange{Reverse: reverse}
+	)
+
+	if m := strings.IndexByte(end, ':'); m != -1 {
+		end, step = end[:m], end[m+1:]
+		if step == "" {
+			// Default step
+		} else if f.Step, err = parseIndex(arg, step, off+n+m+2); err != nil {
+			return FieldRange{}, err
+		} else if f.Step == 0 {
+			return FieldRange{}, &ParseError{
+				Arg:      arg,
+				Offset:   utf8.RuneCountInString(arg[:off+n+m+2]),
+				Selector: -1,
+				Kind:     ErrInvalidRange,
+				Err:      fmt.Errorf("step cannot be 0"),
+			}
+		}
+	}
+
+	if start == "" && end == "" && f.Step == 0 {
+		if reverse {
+			f.Start, f.End = 1, -1
+		}
+		return f, nil
+	} else if start == "" {
+		f.Start = 1
+	} else if f.Start, f.StartName, err = parseEndpoint(arg, start, off); err != nil {
+		return FieldRange{}, err
+	}
+
+	if end == "" {
+		f.End = -1
+	} else if f.End, f.EndName, err = parseEndpoint(arg, end, off+n+1); err != nil {
+		return FieldRange{}, err
+	}
+
+	if f.hasNames() {
+		// Checked by resolve once the names are indices
+		return f, nil
+	} else if err = f.check(); err != nil {
+		return FieldRange{}, &ParseError{
+			Arg:      arg,
+			Selector: -1,
+			Kind:     ErrInvalidRange,
+			Err:      err,
+		}
+	}
+
+	return f, nil
+}
+
+// check returns an error if the range's start and end are inconsistent, such
+// as a start after its end.
+func (r FieldRange) check() error {
+	if r.Start > r.End && ((r.Start < 0 && r.End < 0) || (r.Start > 0 && r.End > 0)) {
+		return fmt.Errorf("start > end is invalid: %d > %d", r.Start, r.End)
+	} else if (r.Start == 0 || r.End == 0) && r.Start != r.End {
+		return fmt.Errorf("start or end cannot be 0 when the other is not 0: %d and %d", r.Start, r.End)
+	}
+	return nil
+}
+
+// parseEndpoint parses the start or end of a field range, s, found at the byte
+// offset off in arg. It is either a field index or a column name.
+func parseEndpoint(arg, s string, off int) (i int, name string, err error) {
+	switch {
+	case strings.HasPrefix(s, "@"):
+		name = s[1:]
+	case s != "" && strings.IndexAny(s[:1], "0123456789+-") == -1:
+		name = s
+	default:
+		i, err = parseIndex(arg, s, off)
+		return i, "", err
+	}
+	if name == "" {
+		return 0, "", &ParseError{
+			Arg:      arg,
+			Offset:   utf8.RuneCountInString(arg[:off]),
+			Selector: -1,
+			Kind:     ErrInvalidName,
+		}
+	}
+	return 0, name, nil
+}
+
+// parseIndex parses a field index, s, found at the byte offset off in arg.
+func parseIndex(arg, s string, off int) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err == nil {
+		return i, nil
+	}
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	return 0, &ParseError{
+		Arg:      arg,
+		Offset:   utf8.RuneCountInString(arg[:off]),
+		Selector: -1,
+		Kind:     ErrInvalidNumber,
+		Err:      fmt.Errorf("%q: %v", s, err),
+	}
+}
+
+// Resolve returns a copy of the range with its column names, if any, replaced
+// by the indices of the columns in header.
+func (r FieldRange) Resolve(header []string) (Filter, error) {
+	return r.resolve(header)
+}
+
+// names returns the range as written with its column names, such as
+// "USER:TIME", for errors.
+func (r FieldRange) names() string {
+	start, end := r.StartName, r.EndName
+	if start == "" {
+		start = strconv.Itoa(r.Start)
+	}
+	if end == "" {
+		end = strconv.Itoa(r.End)
+	}
+	if start == end {
+		return start
+	}
+	return start + ":" + end
+}
+
+// hasNames returns whether the range uses column names.
+func (r FieldRange) hasNames() bool {
+	return r.StartName != "" || r.EndName != ""
+}
+
+func (r FieldRange) resolve(header []string) (FieldRange, error) {
+	var (
+		name = r.names()
+		err  error
+	)
+	if r.StartName != "" {
+		if r.Start, err = columnIndex(header, r.StartName); err != nil {
+			return r, err
+		}
+		r.StartName = ""
+	}
+	if r.EndName != "" {
+		if r.End, err = columnIndex(header, r.EndName); err != nil {
+			return r, err
+		}
+		r.EndName = ""
+	}
+	if err = r.check(); err != nil {
+		return r, fmt.Errorf("columns %s: %w", name, err)
+	}
+	return r, nil
+}
+
+// columnIndex returns the index, starting at 1, of the column named name in
+// header. It is an error if there is no such column or more than one.
+func columnIndex(header []string, name string) (int, error) {
+	if header == nil {
+		return 0, fmt.Errorf("column %q: %w", name, ErrNoHeader)
+	}
+	index := 0
+	for i, col := range header {
+		if col != name {
+			continue
+		} else if index != 0 {
+			return 0, fmt.Errorf("column name %q is ambiguous: columns %d and %d", name, index, i+1)
+		}
+		index = i + 1
+	}
+	if index == 0 {
+		return 0, fmt.Errorf("no column named %q", name)
+	}
+	return index, nil
+}
+
+// Select returns the fields in the range. If the range is the empty
+// FieldRange, it returns zero. If the range has unresolved column names, it
+// returns an error.
+func (r FieldRange) Select(fields []string, zero string) ([]string, error) {
+	if r.hasNames() {
+		_, err := r.resolve(nil)
+		return nil, err
+	}
+	if r.Start == 0 && r.End == 0 {
+		return []string{zero}, nil
+	}
+
+	idx := r.Indices(fields)
+	if len(idx) == 0 {
+		return nil, nil
+	}
+	fs := make([]string, len(idx))
+	for i, fi := range idx {
+		fs[i] = fields[fi]
+	}
+	return fs, nil
+}
+
+// Indices returns the indices of the fields in the range. The empty
+// FieldRange selects the original string, not a field, so it has no indices.
+func (r FieldRange) Indices(fields []string) []int {
+	r = r.abs(fields)
+	if !r.isValid() {
+		return nil
+	}
+
+	start, end := r.Start-1, r.End // [start, end)
+	if n := len(fields); start > n {
+		return nil
+	} else if end > n {
+		end = n
+	}
+
+	var idx []int
+	switch step := r.Step; {
+	case step == 0 || step == 1:
+		idx = make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			idx = append(idx, i)
+		}
+	case step > 0:
+		idx = make([]int, 0, (end-start+step-1)/step)
+		for i := start; i < end; i += step {
+			idx = append(idx, i)
+		}
+	default:
+		idx = make([]int, 0, (end-start-step-1)/-step)
+		for i := end - 1; i >= start; i += step {
+			idx = append(idx, i)
+		}
+	}
+	if r.Reverse {
+		reverseInts(idx)
+	}
+	return idx
+}
+
+func (r FieldRange) abs(fields []string) FieldRange {
+	n := len(fields)
+	r.Start = abs(r.Start, n)
+	r.End = abs(r.End, n)
+	if r.End < r.Start {
+		r.End = r.Start
+	}
+	return r
+}
+
+// isValid returns whether a FieldRange is valid.
+// A FieldRange with negative or zero'd offsets is not valid.
+func (r FieldRange) isValid() bool {
+	return r.Start > 0 && r.End > 0 && r.Start <= r.End
+}
+
+// RegexpFilter selects fields matching its regular expression.
+// Unlike fex proper, this uses Go's RE2 regular expressions, so it's not
+// promised to be backwards compatible.
+type RegexpFilter regexp.Regexp
+
+// NewRegexpFilter compiles s as an RE2 regular expression and returns
+// a RegexpFilter for it.
+func NewRegexpFilter(s string) (*RegexpFilter, error) {
+	rx, err := regexp.Compile(s)
+	if err != nil {
+		return nil, err
+	}
+	return (*RegexpFilter)(rx), nil
+}
+
+func (r *RegexpFilter) regexp() *regexp.Regexp {
+	return (*regexp.Regexp)(r)
+}
+
+// Indices returns the indices of the fields that match the filter's regular
+// expression.
+func (r *RegexpFilter) Indices(fields []string) []int {
+	rx := r.regexp()
+	idx := make([]int, 0, len(fields))
+	for i, f := range fields {
+		if rx.MatchString(f) {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// Select returns the fields that match the filter's regular expression.
+func (r *RegexpFilter) Select(fields []string, _ string) ([]string, error) {
+	rx := r.regexp()
+	fs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if rx.MatchString(f) {
+			fs = append(fs, f)
+		}
+	}
+	return fs, nil
+}
+
+// CaptureFilter selects the submatches of its regular expression in each field
+// that matches it. Fields that don't match are omitted, and each matching field
+// is replaced by one field per submatch. A submatch that doesn't participate in
+// the match is selected as an empty field.
+type CaptureFilter struct {
+	rx     *regexp.Regexp
+	groups []int
+}
+
+// NewCaptureFilter returns a CaptureFilter selecting the given submatches of
+// rx, where 0 is the entire match and 1 is the first parenthesized
+// subexpression. It returns an error if rx has no such submatch.
+func NewCaptureFilter(rx *regexp.Regexp, groups ...int) (*CaptureFilter, error) {
+	for _, g := range groups {
+		if g < 0 || g > rx.NumSubexp() {
+			return nil, fmt.Errorf("regexp %q has no submatch %d", rx, g)
+		}
+	}
+	return &CaptureFilter{rx: rx, groups: append([]int(nil), groups...)}, nil
+}
+
+// Select returns the submatches of each field matching the filter's regular
+// expression.
+func (c *CaptureFilter) Select(fields []string, _ string) ([]string, error) {
+	fs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		m := c.rx.FindStringSubmatch(f)
+		if m == nil {
+			continue
+		}
+		for _, g := range c.groups {
+			fs = append(fs, m[g])
+		}
+	}
+	return fs, nil
+}
+
+// ReplaceFilter replaces all matches of its regular expression in each field
+// with a replacement string. It selects all fields, so the number of fields is
+// unchanged.
+type ReplaceFilter struct {
+	rx   *regexp.Regexp
+	repl string
+}
+
+// NewReplaceFilter returns a ReplaceFilter that replaces matches of rx with
+// repl. Inside repl, $ signs are expanded as in regexp.Regexp.Expand, so $1
+// is replaced by the first submatch.
+func NewReplaceFilter(rx *regexp.Regexp, repl string) *ReplaceFilter {
+	return &ReplaceFilter{rx: rx, repl: repl}
+}
+
+// Select returns the fields with all matches of the filter's regular
+// expression replaced.
+func (r *ReplaceFilter) Select(fields []string, _ string) ([]string, error) {
+	fs := make([]string, len(fields))
+	for i, f := range fields {
+		fs[i] = r.rx.ReplaceAllString(f, r.repl)
+	}
+	return fs, nil
+}
+
+// KeyValueFilter selects the values of key/value pairs, such as level=info or
+// msg="hello world", by their keys. Each field is a pair, split at the first
+// occurrence of the filter's separator. A field without the separator is a key
+// with an empty value.
+type KeyValueFilter struct {
+	sep  string
+	keys []string
+}
+
+// NewKeyValueFilter returns a KeyValueFilter selecting the values of keys,
+// where each key is separated from its value by sep.
+func NewKeyValueFilter(sep string, keys ...string) *KeyValueFilter {
+	return &KeyValueFilter{sep: sep, keys: append([]string(nil), keys...)}
+}
+
+// Select returns the values of the pairs with the filter's keys, in the order
+// of its keys. If a key occurs more than once, each of its values is selected.
+// Quoted values are unquoted: double-quoted values are unquoted as Go strings
+// if possible, so escape sequences such as \n are replaced, and as with
+// QuotedSplit otherwise.
+func (f *KeyValueFilter) Select(fields []string, _ string) ([]string, error) {
+	keys := make([]string, len(fields))
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		keys[i], values[i] = field, ""
+		if n := strings.Index(field, f.sep); n != -1 {
+			keys[i], values[i] = field[:n], field[n+len(f.sep):]
+		}
+	}
+
+	fs := make([]string, 0, len(f.keys))
+	for _, key := range f.keys {
+		for i, k := range keys {
+			if k == key {
+				fs = append(fs, unquoteValue(values[i]))
+			}
+		}
+	}
+	return fs, nil
+}
+
+// unquoteValue removes quotes and escapes from a value selected by
+// KeyValueFilter.
+func unquoteValue(v string) string {
+	if strings.IndexAny(v, "\"'\\") == -1 {
+		return v
+	}
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		if u, err := strconv.Unquote(v); err == nil {
+			return u
+		}
+	}
+	return QuotedSplit(false, true)("", v)[0]
+}
@@ -0,0 +1,248 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NoSplit returns s as the only field, ignoring delim.
+func NoSplit(_, s string) []string {
+	return []string{s}
+}
+
+// JSONFilter parses each field as a JSON value and selects the values found at
+// its paths, such as ".user.id" or ".items[-1].name". Strings are selected
+// without quotes, numbers, booleans and null as they're written, and objects
+// and arrays as compact JSON.
+type JSONFilter struct {
+	paths []jsonPath
+}
+
+// jsonPath is a sequence of steps into a JSON value.
+type jsonPath []jsonStep
+
+// jsonStep is a single object key, array index, or wildcard of a JSON path.
+type jsonStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// ParseJSONFilter parses a comma-separated list of JSON paths, such as
+// ".user.id,.req.path", and returns a JSONFilter selecting them. If s cannot
+// be parsed, the error is a *ParseError.
+//
+// A path is made up of object keys, written .key or ["key"] (as a JSON
+// string), array indices, written [N], and wildcards, written .* or [*], which
+// select every value of an object (in key order) or array. Array indices start
+// at 0, and a negative index counts from the end of an array, so [-1] is its
+// last element. The path "." selects the whole value. Keys containing '.', '[',
+// or '|' must be written as ["key"].
+func ParseJSONFilter(s string) (*JSONFilter, error) {
+	var (
+		f   JSONFilter
+		off int // Byte offset of the current path
+	)
+	for _, spec := range strings.Split(s, ",") {
+		path, err := parseJSONPath(spec)
+		if err != nil {
+			pe := err.(*ParseError)
+			pe.Arg, pe.Offset = s, utf8.RuneCountInString(s[:off])+pe.Offset
+			return nil, pe
+		}
+		f.paths = append(f.paths, path)
+		off += len(spec) + 1
+	}
+	return &f, nil
+}
+
+func parseJSONPath(s string) (jsonPath, error) {
+	var (
+		path jsonPath
+		i    = 0
+	)
+	fail := func(at int, err error) (jsonPath, error) {
+		return nil, &ParseError{
+			Arg:      s,
+			Offset:   utf8.RuneCountInString(s[:at]),
+			Selector: -1,
+			Kind:     ErrInvalidPath,
+			Err:      err,
+		}
+	}
+
+	if s == "." {
+		return path, nil
+	} else if s == "" || (s[0] != '.' && s[0] != '[') {
+		return fail(0, errors.New("path must start with '.' or '['"))
+	}
+
+	for i < len(s) {
+		start := i
+		switch s[i] {
+		case '.':
+			i++
+			end := strings.IndexAny(s[i:], ".[|")
+			if end == -1 {
+				end = len(s) - i
+			}
+			key := s[i : i+end]
+			switch key {
+			case "":
+				return fail(start, errors.New("empty key"))
+			case "*":
+				path = append(path, jsonStep{wildcard: true})
+			default:
+				path = append(path, jsonStep{key: key})
+			}
+			i += end
+
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if s[i+1:] != "" && s[i+1] == '"' {
+				// Find the closing quote, then the bracket
+				dec := json.NewDecoder(strings.NewReader(s[i+1:]))
+				var key string
+				if err := dec.Decode(&key); err != nil {
+					return fail(start+1, err)
+				}
+				end = int(dec.InputOffset()) + 1
+				if i+end >= len(s) || s[i+end] != ']' {
+					return fail(start, errors.New("missing ']'"))
+				}
+				path = append(path, jsonStep{key: key})
+				i += end + 1
+				continue
+			} else if end == -1 {
+				return fail(start, errors.New("missing ']'"))
+			}
+
+			index := s[i+1 : i+end]
+			if index == "*" {
+				path = append(path, jsonStep{wildcard: true})
+			} else if n, err := strconv.Atoi(index); err != nil || index == "" {
+				return fail(start+1, fmt.Errorf("invalid index %q", index))
+			} else {
+				path = append(path, jsonStep{index: n, isIndex: true})
+			}
+			i += end + 1
+
+		default:
+			return fail(start, fmt.Errorf("unexpected %q", s[i]))
+		}
+	}
+	return path, nil
+}
+
+// Select parses each field as JSON and returns the values found at the
+// filter's paths. Paths that aren't found select nothing. It returns an error
+// if a field isn't valid JSON.
+func (f *JSONFilter) Select(fields []string, _ string) ([]string, error) {
+	var fs []string
+	for _, field := range fields {
+		dec := json.NewDecoder(strings.NewReader(field))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		} else if _, err := dec.Token(); err != io.EOF {
+			return nil, errors.New("invalid JSON: data after value")
+		}
+
+		for _, path := range f.paths {
+			for _, v := range path.find(v) {
+				fs = append(fs, jsonText(v))
+			}
+		}
+	}
+	return fs, nil
+}
+
+// find returns the values at the path in v.
+func (path jsonPath) find(v interface{}) []interface{} {
+	values := []interface{}{v}
+	for _, step := range path {
+		var next []interface{}
+		for _, v := range values {
+			next = step.find(v, next)
+		}
+		values = next
+	}
+	return values
+}
+
+// find appends the values at the step in v to values.
+func (step jsonStep) find(v interface{}, values []interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				values = append(values, v[k])
+			}
+		} else if e, ok := v[step.key]; ok && !step.isIndex {
+			values = append(values, e)
+		}
+	case []interface{}:
+		if step.wildcard {
+			values = append(values, v...)
+		} else if i := step.index; step.isIndex {
+			if i < 0 {
+				i = abs(i, len(v)) - 1
+			}
+			if i >= 0 && i < len(v) {
+				values = append(values, v[i])
+			}
+		}
+	}
+	return values
+}
+
+// jsonText returns the text selected for the JSON value v.
+func jsonText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return string(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,961 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+// NOTE: This source file borrows heavily from the original fex.c, including the
+// general structure and semantics of the program.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MustCompileExtractor is like CompileExtractor but panics if arg cannot be
+// compiled.
+func MustCompileExtractor(arg string) Extractor {
+	ex, err := CompileExtractor(arg)
+	if err != nil {
+		panic(fmt.Sprintf("fex: CompileExtractor(%q): %v", arg, err))
+	}
+	return ex
+}
+
+// CompileExtractor parses an extract, such as "1" or `"2 /addr:/:-1`, and
+// returns its Extractor. If the extract cannot be parsed, the error is
+// a *ParseError.
+func CompileExtractor(arg string) (Extractor, error) {
+	return newParser(arg).parse()
+}
+
+// CompileExtractorDelim is like CompileExtractor, but the first selector of
+// the extract is delimited by delim, instead of a space, if it has no
+// delimiter of its own. For example, "1" compiled with a delim of "\n" selects
+// the first line of its input.
+func CompileExtractorDelim(arg, delim string) (Extractor, error) {
+	p := newParser(arg)
+	p.delim = delim
+	return p.parse()
+}
+
+// parser holds the state of an extract being compiled. Extracts are parsed
+// from right to left, since a selector's delimiter precedes its fields.
+type parser struct {
+	arg  string
+	sr   []rune
+	offs []int // Byte offsets of runes in arg, plus len(arg)
+	i    int   // Current rune index, decreasing
+
+	// delim is the delimiter of the first selector if it has none.
+	delim string
+
+	// start is the rune index of the first rune of the current selector's
+	// fields. It is used to locate the selector of an error.
+	start int
+	// nested is true if the parser is only counting selectors for an error.
+	nested bool
+}
+
+func newParser(arg string) *parser {
+	sr := []rune(arg)
+	p := &parser{
+		arg:  arg,
+		sr:   sr,
+		offs: make([]int, len(sr)+1),
+		i:    len(sr) - 1,
+
+		delim: " ",
+	}
+
+	// Compute string offsets of runes
+	i := 0
+	for off := range arg {
+		p.offs[i] = off
+		i++
+	}
+	// Could omit zeroeth index here but not worth it
+	p.offs[i] = len(arg)
+	return p
+}
+
+func (p *parser) parse() (Extractor, error) {
+	var ex Extractor
+
+	// Walk rune sequence
+	for ; p.i >= 0; p.i-- {
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		ex = append(ex, sel)
+	}
+
+	for j := len(ex)/2 - 1; j >= 0; j-- {
+		opp := len(ex) - 1 - j
+		ex[j], ex[opp] = ex[opp], ex[j]
+	}
+
+	return ex, nil
+}
+
+// selector parses the selector ending at p.i, leaving p.i at the first rune of
+// the selector (i.e., the start of its delimiter, if any).
+func (p *parser) selector() (Selector, error) {
+	var (
+		sr       = p.sr
+		i        = p.i
+		greedy   = true
+		quote    rune // Quote-aware tokenizing, from a group's '"' or '\'' prefix
+		quoteAt  int
+		keyValue bool // A key/value selector, whose delimiter separates pairs
+		join     string
+		joined   bool
+		filter   Filter
+		g        groupSpec
+		err      error
+	)
+
+	// Until the selector's fields are found, treat the rune at i as the
+	// fields of a selector that failed to parse.
+	p.start = i
+
+	// Join override, ='...'
+	if sr[i] == '\'' {
+		if open := p.openQuote(i); open > 0 && sr[open-1] == '=' {
+			join, joined = unquote(p.slice(open+1, i)), true
+			i = open - 2
+			if i < 0 {
+				return Selector{}, p.errorAt(ErrUnexpectedRune, open-1, fmt.Errorf("%q", '='))
+			}
+			p.i, p.start = i, i
+		}
+	}
+
+	switch r := sr[i]; {
+	case r == '}' && p.jsonGroup(i) != -1: // JSON selector, @{path,...}
+		at := p.jsonGroup(i)
+		p.start = at + 1
+		return p.jsonSelector(at+2, i, join, joined)
+
+	case r == '}': // group or key/value selector
+		var ok bool
+		if filter, i, ok, err = p.keyValue(i); err != nil {
+			return Selector{}, err
+		} else if ok {
+			keyValue = true
+			break
+		}
+
+		g, err = p.group(i)
+		if err != nil {
+			return Selector{}, err
+		}
+		filter, greedy, quote, quoteAt = g.filter, g.greedy, g.quote, g.quoteAt
+		i = g.start - 1
+
+		// Rune and byte ranges, #{...} and %{...}, have no delimiter.
+		if i >= 0 && (sr[i] == '#' || sr[i] == '%') && (i == 0 || sr[i-1] != '\\') {
+			if quote != 0 {
+				return Selector{}, p.errorAt(ErrUnexpectedRune, quoteAt, fmt.Errorf("%q", quote))
+			}
+			tokenizer := RuneSplit
+			if sr[i] == '%' {
+				tokenizer = ByteSplit
+			}
+			p.i = i
+			sel := NewSelector("", tokenizer, filter)
+			if joined {
+				sel = sel.WithJoin(join)
+			}
+			return sel, nil
+		}
+
+	case p.regexpEnd(i) != -1: // regexp or substitution selector
+		var ok bool
+		if filter, i, ok, err = p.substitution(i); err != nil {
+			return Selector{}, err
+		} else if ok {
+			break
+		}
+
+		var rs regexpSpec
+		rs, err = p.regexpSelector(i)
+		if err != nil {
+			return Selector{}, err
+		}
+		filter = rs.Filter()
+		i = rs.next
+
+	case p.transformStart(i) != -1: // transform, |name(args)
+		return p.transform(p.transformStart(i), i, join, joined)
+
+	case !unicode.IsDigit(r) && p.jsonStart(i) != -1: // JSON selector, @.path
+		at := p.jsonStart(i)
+		p.start = at + 1
+		return p.jsonSelector(at+1, i+1, join, joined)
+
+	case unicode.IsDigit(r): // Simple selector
+		start := p.findf(i, func(r rune) bool { return !unicode.IsDigit(r) })
+		if start > -1 && sr[start] == '-' {
+			start--
+		}
+		p.start = start + 1
+		if err = p.checkJSONKey(start, i); err != nil {
+			return Selector{}, err
+		}
+		digits := p.slice(start+1, i+1)
+		var fr FieldRange
+		fr, err = ParseFieldRange(digits)
+		if err != nil {
+			return Selector{}, p.rebase(err, start+1)
+		}
+		filter = fr
+		i = start
+
+	default:
+		return Selector{}, p.errorAt(ErrUnexpectedRune, i, fmt.Errorf("%q", r))
+	}
+
+	sep, next, kind := p.delimiter(i)
+	p.i = next + 1
+
+	var tokenizer SplitFunc
+	switch {
+	case kind == quotedDelim && sep == "":
+		return Selector{}, p.errorAt(ErrEmptyDelimiter, next+1, nil)
+	case kind == regexpDelim && quote != 0:
+		return Selector{}, p.errorAt(ErrUnexpectedRune, quoteAt,
+			fmt.Errorf("%q cannot be used with a regexp delimiter", quote))
+	case kind == regexpDelim && keyValue:
+		return Selector{}, p.errorAt(ErrUnexpectedRune, next+1,
+			errors.New("key/value selectors cannot use a regexp delimiter"))
+	case quote != 0:
+		tokenizer = QuotedSplit(greedy, quote == '"')
+	case keyValue:
+		tokenizer = QuotedSplit(true, false)
+	case kind == regexpDelim:
+		var rx *regexp.Regexp
+		rx, err = regexp.Compile(sep)
+		if err != nil {
+			return Selector{}, p.errorAt(ErrInvalidRegexp, next+3, err)
+		}
+		if greedy {
+			tokenizer = GreedyRegexpSplit(rx)
+		} else {
+			tokenizer = NonGreedyRegexpSplit(rx)
+		}
+		if !joined {
+			join, joined = " ", true
+		}
+	case !greedy:
+		tokenizer = NonGreedySplit
+	case kind == quotedDelim:
+		tokenizer = GreedyStringSplit
+	default:
+		tokenizer = GreedySplit
+	}
+
+	sel := NewSelector(sep, tokenizer, filter)
+	if joined {
+		sel = sel.WithJoin(join)
+	}
+	return sel, nil
+}
+
+// keyValue parses the key/value selector, ={key,...}, ending with the brace at
+// the rune index end. The '=' may be followed by a key/value separator other
+// than '=', as in =:{key,...}. If there is no key/value selector ending at end,
+// ok is false and next is end.
+//
+// Since ={1,2} is a group delimited by '=', ={...} is only a key/value selector
+// if the group contains a key that isn't a field number or range.
+func (p *parser) keyValue(end int) (filter Filter, next int, ok bool, err error) {
+	var (
+		sr      = p.sr
+		open    = p.find(end, '{')
+		escaped = func(i int) bool { return i > 0 && sr[i-1] == '\\' }
+		marker  int
+		sep     = "="
+	)
+	switch {
+	case open >= 1 && sr[open-1] == '=' && !escaped(open-1):
+		marker = open - 1
+		if g, err := ParseGroup(p.slice(open+1, end)); err == nil && !g.hasNames() {
+			return nil, end, false, nil
+		}
+	case open >= 2 && sr[open-2] == '=' && !escaped(open-2) && sr[open-1] != '\\' &&
+		!(sr[open-1] == '\'' && p.openQuote(open-1) != -1):
+		// A quote closing a quoted delimiter, as in '='{2}, isn't a separator
+		marker, sep = open-2, p.slice(open-1, open)
+	default:
+		return nil, end, false, nil
+	}
+	p.start = marker
+
+	keys := strings.Split(p.slice(open+1, end), ",")
+	off := open + 1
+	for _, key := range keys {
+		if key == "" {
+			return nil, marker - 1, true, p.errorAt(ErrInvalidKey, off, nil)
+		}
+		off += len([]rune(key)) + 1
+	}
+	return NewKeyValueFilter(sep, keys...), marker - 1, true, nil
+}
+
+// groupSpec is a group selector parsed by parser.group.
+type groupSpec struct {
+	filter  Filter
+	greedy  bool // False if the group has the '?' prefix
+	quote   rune // The '"' or '\'' prefix, if any
+	quoteAt int  // Index of the quote prefix, if any
+	start   int  // Index of the opening brace
+}
+
+// group parses the group selector ending with the brace at the rune index end.
+func (p *parser) group(end int) (g groupSpec, err error) {
+	var (
+		sr = p.sr
+		rs = regexpSpec{open: -1}
+	)
+
+	// A group may hold a single regexp, as in {!/regexp/}. Since the regexp
+	// may contain braces, it's scanned before looking for the opening brace.
+	if end > 0 && p.regexpEnd(end-1) != -1 {
+		rs, err = p.regexpSelector(end - 1)
+		g.start = rs.next
+		for g.start >= 0 && isGroupPrefix(sr[g.start]) {
+			g.start--
+		}
+		if rs.open <= 0 || g.start < 0 || sr[g.start] != '{' {
+			rs.open = -1
+		} else if err != nil {
+			return g, err
+		} else if rs.captures != nil {
+			return g, p.errorAt(ErrInvalidCapture, rs.capture, errors.New("captures cannot be used in a group"))
+		}
+	}
+	if rs.open == -1 {
+		g.start = p.find(end, '{')
+		if g.start == -1 {
+			return g, p.errorAt(ErrUnmatchedBrace, end, nil)
+		}
+	}
+	p.start = g.start
+
+	g.greedy = true
+	negate := false
+	subStart := g.start + 1
+	for ; subStart < end && isGroupPrefix(sr[subStart]); subStart++ {
+		switch r := sr[subStart]; r {
+		case '?':
+			g.greedy = false
+		case '!':
+			negate = true
+		default:
+			if g.quote != 0 && g.quote != r {
+				return g, p.errorAt(ErrUnexpectedRune, subStart, fmt.Errorf("%q", r))
+			}
+			g.quote, g.quoteAt = r, subStart
+		}
+	}
+
+	var indexer Indexer
+	if rs.open != -1 {
+		indexer, g.filter = rs.filter, rs.filter
+		negate = negate != rs.invert
+	} else {
+		group, err := ParseGroup(p.slice(subStart, end))
+		if err != nil {
+			return g, p.rebase(err, subStart)
+		}
+		indexer, g.filter = group, group
+	}
+
+	if negate {
+		g.filter = Complement{Of: indexer}
+	}
+	return g, nil
+}
+
+// isGroupPrefix returns whether r is one of the prefixes that may follow
+// a group's opening brace: '?', '!', or a double or single quote.
+func isGroupPrefix(r rune) bool {
+	return r == '?' || r == '!' || r == '"' || r == '\''
+}
+
+// jsonSelector returns the JSON selector for the paths between the rune
+// indices start and end. Its values are joined by a space unless joined is
+// true.
+func (p *parser) jsonSelector(start, end int, join string, joined bool) (Selector, error) {
+	filter, err := ParseJSONFilter(p.slice(start, end))
+	if err != nil {
+		return Selector{}, p.rebase(err, start)
+	}
+	p.i = start - 1
+	if p.sr[start-1] == '{' {
+		p.i--
+	}
+	if !joined {
+		join = " "
+	}
+	return NewSelector("", NoSplit, filter).WithJoin(join), nil
+}
+
+// checkJSONKey returns an error if the delimiter at the rune index delim, which
+// precedes the field index ending at the rune index i, could be part of the key
+// of a JSON path, as in "@.ipv4", which would otherwise select field 4 of the
+// key "ip" split by 'v'.
+func (p *parser) checkJSONKey(delim, i int) error {
+	sr := p.sr
+	if delim < 1 || !(unicode.IsLetter(sr[delim]) || sr[delim] == '_') || sr[delim-1] == '\\' {
+		return nil
+	}
+	at := p.jsonStart(delim)
+	if at == -1 {
+		return nil
+	}
+	path := p.slice(at+1, delim+1)
+	if strings.IndexFunc(path, unicode.IsSpace) != -1 {
+		return nil
+	} else if _, err := parseJSONPath(path); err != nil {
+		return nil
+	}
+	full := p.slice(at+1, i+1)
+	return p.errorAt(ErrInvalidPath, delim, fmt.Errorf(
+		"%q is ambiguous; write @{%s} for the key",
+		"@"+full, full))
+}
+
+// transformStart returns the index of the '|' beginning the transform,
+// |name or |name(args), that ends at the rune index i, or -1 if there is none.
+func (p *parser) transformStart(i int) int {
+	sr := p.sr
+	if sr[i] == ')' {
+		if i = p.transformOpen(i); i == -1 {
+			return -1
+		}
+		i--
+	}
+	q := i
+	for q >= 0 && (sr[q] == '_' || unicode.IsLetter(sr[q]) || unicode.IsDigit(sr[q])) {
+		q--
+	}
+	if q == i || q < 0 || sr[q] != '|' || !unicode.IsLetter(sr[q+1]) || (q > 0 && sr[q-1] == '\\') {
+		return -1
+	}
+	return q
+}
+
+// transformOpen returns the index of the parenthesis opening the arguments of
+// a transform that end with the parenthesis at the rune index end, or -1 if
+// there is none. Quoted arguments may contain parentheses.
+func (p *parser) transformOpen(end int) int {
+	for q := end - 1; q >= 0; q-- {
+		switch p.sr[q] {
+		case '(':
+			return q
+		case '\'':
+			if open := p.openQuote(q); open != -1 {
+				q = open
+			}
+		}
+	}
+	return -1
+}
+
+// transform parses the transform beginning with the '|' at the rune index
+// start and ending at the rune index end. Its arguments are separated by
+// commas, and may be quoted like delimiters to include commas or parentheses.
+func (p *parser) transform(start, end int, join string, joined bool) (Selector, error) {
+	var (
+		sr   = p.sr
+		name = p.slice(start+1, end+1)
+		args []string
+	)
+	p.start = start + 1
+	if sr[end] == ')' {
+		open := p.transformOpen(end)
+		name = p.slice(start+1, open)
+		for q := open + 1; q < end; q++ {
+			next := q
+			for next < end && sr[next] != ',' {
+				next++
+			}
+			arg := p.slice(q, next)
+			if sr[q] == '\'' {
+				close := q + 1
+				for close < end && sr[close] != '\'' {
+					if sr[close] == '\\' {
+						close++
+					}
+					close++
+				}
+				if close >= end || (close+1 < end && sr[close+1] != ',') {
+					return Selector{}, p.errorAt(ErrTransform, q, errors.New("unterminated quoted argument"))
+				}
+				arg, next = unquote(p.slice(q+1, close)), close+1
+			}
+			args = append(args, arg)
+			if q = next; q == end-1 && sr[q] == ',' {
+				args = append(args, "")
+			}
+		}
+	}
+
+	filter, err := NewTransformFilter(name, args...)
+	if err != nil {
+		return Selector{}, p.errorAt(ErrTransform, start+1, err)
+	}
+	p.i = start
+	if !joined {
+		join = " "
+	}
+	return NewSelector("", NoSplit, filter).WithJoin(join), nil
+}
+
+// jsonStart returns the index of the '@' beginning the JSON selector, @.path,
+// that ends at the rune index i, or -1 if there is none.
+func (p *parser) jsonStart(i int) int {
+	sr := p.sr
+	for q := i - 1; q >= 0; q-- {
+		if sr[q] == '@' && (sr[q+1] == '.' || sr[q+1] == '[') && (q == 0 || sr[q-1] != '\\') {
+			return q
+		}
+	}
+	return -1
+}
+
+// jsonGroup returns the index of the '@' beginning the JSON selector,
+// @{path,...}, that ends with the brace at the rune index end, or -1 if there
+// is none. Since the paths must begin with '.' or '[', a group delimited by
+// '@', as in @{1,2}, isn't a JSON selector.
+func (p *parser) jsonGroup(end int) int {
+	sr := p.sr
+	open := p.find(end, '{')
+	if open < 1 || open+1 == end || sr[open-1] != '@' || (open > 1 && sr[open-2] == '\\') {
+		return -1
+	} else if sr[open+1] != '.' && sr[open+1] != '[' {
+		return -1
+	}
+	return open - 1
+}
+
+// regexpSpec is a regexp selector parsed by parser.regexpSelector.
+type regexpSpec struct {
+	filter   *RegexpFilter
+	invert   bool  // The '!' flag
+	captures []int // Submatches named by $N or $name, if any
+	capture  int   // Index of the first '$', if any
+	open     int   // Index of the opening slash, or -1
+	next     int   // Index of the rune preceding the regexp
+}
+
+// Filter returns the Filter for the regexp selector.
+func (rs *regexpSpec) Filter() Filter {
+	switch {
+	case rs.captures != nil:
+		return &CaptureFilter{rx: rs.filter.regexp(), groups: rs.captures}
+	case rs.invert:
+		return Complement{Of: rs.filter}
+	default:
+		return rs.filter
+	}
+}
+
+// regexpSelector parses the regexp selector ending at the rune index end. The
+// regexp may be followed by flags and submatch references, as in /regexp/i or
+// /key=(\S+)/$1.
+func (p *parser) regexpSelector(end int) (rs regexpSpec, err error) {
+	var (
+		sr    = p.sr
+		slash = p.regexpEnd(end)
+		flags []rune
+		refs  []int // Indices of '$' runes
+		rx    string
+	)
+	rx, rs.open, rs.next = p.regexp(slash)
+	p.start = rs.next + 1
+
+	q := slash + 1
+	for ; q <= end && sr[q] != '$'; q++ {
+		switch r := sr[q]; r {
+		case '!':
+			rs.invert = true
+		case 'i', 'm', 's', 'U':
+			flags = append(flags, r)
+		default:
+			return rs, p.errorAt(ErrUnknownFlag, q, fmt.Errorf("%q", r))
+		}
+	}
+	for ; q <= end; q++ {
+		if sr[q] == '$' {
+			refs = append(refs, q)
+		}
+	}
+	if len(flags) > 0 {
+		rx = "(?" + string(flags) + ")" + rx
+	}
+
+	rs.filter, err = NewRegexpFilter(rx)
+	if err != nil {
+		return rs, p.errorAt(ErrInvalidRegexp, rs.open+1, err)
+	}
+
+	if len(refs) == 0 {
+		return rs, nil
+	}
+	rs.capture = refs[0]
+	if rs.invert {
+		return rs, p.errorAt(ErrInvalidCapture, rs.capture, errors.New("captures cannot be used with the '!' flag"))
+	}
+
+	rxp := rs.filter.regexp()
+	rs.captures = make([]int, len(refs))
+	for i, ref := range refs {
+		refEnd := end + 1
+		if i+1 < len(refs) {
+			refEnd = refs[i+1] - 1 // Skip comma
+		}
+		name := p.slice(ref+1, refEnd)
+		n, err := strconv.Atoi(name)
+		if err != nil {
+			n = rxp.SubexpIndex(name)
+		}
+		if n < 0 || n > rxp.NumSubexp() {
+			return rs, p.errorAt(ErrInvalidCapture, ref, fmt.Errorf("no submatch %q", name))
+		}
+		rs.captures[i] = n
+	}
+	return rs, nil
+}
+
+// substitution parses the substitution selector, s/regexp/replacement/, ending
+// at the rune index end. The closing slash may be followed by the flags i, m,
+// s, and U. If there is no substitution ending at end, ok is false and next is
+// end.
+func (p *parser) substitution(end int) (filter Filter, next int, ok bool, err error) {
+	var (
+		sr    = p.sr
+		slash = p.regexpEnd(end)
+	)
+	repl, mid, _ := p.regexp(slash)
+	if mid <= 0 {
+		return nil, end, false, nil
+	}
+	rx, open, _ := p.regexp(mid)
+	if open < 1 || sr[open-1] != 's' || (open > 1 && sr[open-2] == '\\') {
+		return nil, end, false, nil
+	}
+	next = open - 2
+	p.start = open - 1
+
+	var flags []rune
+	for q := slash + 1; q <= end; q++ {
+		switch r := sr[q]; r {
+		case 'i', 'm', 's', 'U':
+			flags = append(flags, r)
+		case 'g':
+			// Every match is replaced, but g is accepted as in sed.
+		default:
+			return nil, next, true, p.errorAt(ErrUnknownFlag, q, fmt.Errorf("%q", r))
+		}
+	}
+	if len(flags) > 0 {
+		rx = "(?" + string(flags) + ")" + rx
+	}
+
+	rxp, err := regexp.Compile(rx)
+	if err != nil {
+		return nil, next, true, p.errorAt(ErrInvalidRegexp, open+1, err)
+	}
+	return NewReplaceFilter(rxp, repl), next, true, nil
+}
+
+// regexpEnd returns the index of the closing slash of the regexp ending at the
+// rune index i, which may be followed by flags and a comma-separated list of
+// submatch references, as in /regexp/i$1,$name. If there is no regexp ending
+// at i, it returns -1.
+func (p *parser) regexpEnd(i int) int {
+	var (
+		sr = p.sr
+		q  = i
+	)
+
+	// Submatch references
+	for {
+		k := q
+		for k >= 0 && (sr[k] == '_' || unicode.IsLetter(sr[k]) || unicode.IsDigit(sr[k])) {
+			k--
+		}
+		if k == q || k < 0 || sr[k] != '$' {
+			break
+		}
+		q = k - 1
+		if q < 0 || sr[q] != ',' {
+			break
+		}
+		q--
+	}
+
+	// Flags
+	for q >= 0 && (sr[q] == '!' || unicode.IsLetter(sr[q])) {
+		q--
+	}
+
+	if q >= 0 && sr[q] == '/' {
+		return q
+	}
+	return -1
+}
+
+// delimKind is the kind of delimiter returned by parser.delimiter.
+type delimKind int
+
+const (
+	runeDelim   delimKind = iota // A single rune, possibly escaped: ':' or '\t'
+	quotedDelim                  // A quoted string: '->'
+	regexpDelim                  // A regexp: ~/[,;]\s*/~
+)
+
+// delimiter returns the delimiter ending at the rune index i and the index of
+// the rune preceding it. If i is negative, the delimiter is a space. A quoted
+// delimiter may be empty. For a regexp delimiter, sep is the uncompiled
+// regexp.
+func (p *parser) delimiter(i int) (sep string, next int, kind delimKind) {
+	sr := p.sr
+	if i < 0 {
+		return p.delim, i, runeDelim
+	}
+
+	switch sr[i] {
+	case '\'':
+		if open := p.openQuote(i); open != -1 {
+			return unquote(p.slice(open+1, i)), open - 1, quotedDelim
+		}
+	case '~':
+		if i > 0 && sr[i-1] == '/' {
+			rx, open, next := p.regexp(i - 1)
+			if open > 0 && next == open-1 && sr[next] == '~' {
+				return rx, next - 1, regexpDelim
+			}
+		}
+	}
+
+	if i == 0 || sr[i-1] != '\\' {
+		return p.slice(i, i+1), i - 1, runeDelim
+	}
+	return unescape(sr[i], p.slice(i, i+1)), i - 2, runeDelim
+}
+
+// regexp scans the regexp ending with the slash at the rune index end. It
+// returns the regexp with escaped slashes replaced, the index of its opening
+// slash (-1 if there is none), and the index of the rune preceding the regexp.
+func (p *parser) regexp(end int) (rx string, open, next int) {
+	var (
+		sr     = p.sr
+		i      = end
+		chunks []string
+	)
+	open = -1
+	for start := p.find(i, '/'); start != -1; start = p.find(i, '/') {
+		open = start
+		if chunk := p.slice(start+1, i); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		i = start
+
+		escaped := start > 1 && sr[start-1] == '\\'
+		if !escaped {
+			i--
+			break
+		}
+		i = p.findf(i, func(r rune) bool { return r != '\\' }) + 1
+		escapes := start - i
+		if escapes%2 == 0 {
+			// Not escaped -- delimiter is a backslash
+			break
+		}
+		chunks = append(chunks, p.slice(start-(escapes-1)/2, start+1))
+	}
+
+	reverseStrings(chunks)
+	return strings.Join(chunks, ""), open, i
+}
+
+// openQuote returns the index of the unescaped single quote opening the quoted
+// string that ends at the rune index i, or -1 if there is none.
+func (p *parser) openQuote(i int) int {
+	for q := i - 1; q >= 0; q-- {
+		if p.sr[q] != '\'' {
+			continue
+		}
+		escapes := 0
+		for e := q - 1; e >= 0 && p.sr[e] == '\\'; e-- {
+			escapes++
+		}
+		if escapes%2 == 0 {
+			return q
+		}
+	}
+	return -1
+}
+
+// Unescape returns s with the escape sequences recognized in quoted
+// delimiters, such as \t, \n, \z (NUL), and \e (ESC), replaced. A backslash
+// followed by any other character is replaced by that character, so \\ is
+// a backslash.
+func Unescape(s string) string {
+	return unquote(s)
+}
+
+// unquote returns the contents of a quoted delimiter with its escape sequences
+// replaced.
+func unquote(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+	var (
+		b       strings.Builder
+		escaped bool
+	)
+	for _, r := range s {
+		if escaped {
+			b.WriteString(unescape(r, string(r)))
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	if escaped {
+		b.WriteByte('\\')
+	}
+	return b.String()
+}
+
+// unescape returns the string for the escape sequence '\' followed by r. If
+// r is not a known escape, it returns def.
+func unescape(r rune, def string) string {
+	switch r {
+	case '\\':
+		return "\\"
+	case 'a':
+		return "\a"
+	case 'b':
+		return "\b"
+	case 'f':
+		return "\f"
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case 'v':
+		return "\v"
+	case 'z':
+		return "\x00"
+	case 'e':
+		return "\x1B"
+	default:
+		return def
+	}
+}
+
+// slice returns the substring of arg from the rune index i up to j.
+func (p *parser) slice(i, j int) string {
+	return p.arg[p.offs[i]:p.offs[j]]
+}
+
+// find returns the index of the nearest rune r preceding the rune index i, or
+// -1.
+func (p *parser) find(i int, r rune) int {
+	for q := i - 1; q >= 0; q-- {
+		if p.sr[q] == r {
+			return q
+		}
+	}
+	return -1
+}
+
+// findf returns the index of the nearest rune preceding the rune index i for
+// which f returns true, or -1.
+func (p *parser) findf(i int, f func(r rune) bool) int {
+	for q := i - 1; q >= 0; q-- {
+		if f(p.sr[q]) {
+			return q
+		}
+	}
+	return -1
+}
+
+// errorAt returns a *ParseError for the current selector at the rune index off.
+func (p *parser) errorAt(kind ErrorKind, off int, err error) *ParseError {
+	return &ParseError{
+		Arg:      p.arg,
+		Offset:   off,
+		Selector: p.selectorIndex(),
+		Kind:     kind,
+		Err:      err,
+	}
+}
+
+// rebase converts a *ParseError returned by ParseGroup or ParseFieldRange for
+// a substring beginning at the rune index off to an error for the current
+// selector.
+func (p *parser) rebase(err error, off int) error {
+	pe, ok := err.(*ParseError)
+	if !ok {
+		return p.errorAt(ErrInvalidRange, off, err)
+	}
+	return p.errorAt(pe.Kind, off+pe.Offset, pe.Err)
+}
+
+// selectorIndex returns the index of the current selector by compiling the
+// extract preceding it. If the preceding extract cannot be compiled, which can
+// happen when the selector failed before its delimiter was found, the longest
+// prefix of the extract before the selector that compiles is used instead.
+func (p *parser) selectorIndex() int {
+	if p.nested {
+		return -1
+	}
+	_, next, _ := p.delimiter(p.start - 1)
+	if next < 0 {
+		return 0
+	} else if n, ok := p.countSelectors(next + 1); ok {
+		return n
+	}
+	for end := p.start; end > 0; end-- {
+		if n, ok := p.countSelectors(end); ok {
+			return n
+		}
+	}
+	return 0
+}
+
+// countSelectors returns the number of selectors in the extract preceding the
+// rune index end, and whether it compiles.
+func (p *parser) countSelectors(end int) (int, bool) {
+	prev := newParser(p.slice(0, end))
+	prev.nested = true
+	ex, err := prev.parse()
+	return len(ex), err == nil
+}
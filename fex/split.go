@@ -0,0 +1,310 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SplitFunc is a function that tokenizes s by a delimiter, delim. It is used by
+// a Selector to produce the fields passed to its Filter.
+type SplitFunc func(delim, s string) []string
+
+// GreedySplit splits s along a delimiter, omitting empty splits from the
+// resulting slice. Each rune of delim is treated as a separate delimiter.
+//
+// For example, ":foo:" split by ":" will produce []string{"foo"}.
+// This can result in empty slices.
+func GreedySplit(delim, s string) []string {
+	fn := func(r rune) bool {
+		for _, dr := range delim {
+			if r == dr {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.FieldsFunc(s, fn)
+}
+
+// GreedyStringSplit splits s along a delimiter, omitting empty splits from the
+// resulting slice. Unlike GreedySplit, delim is treated as a single delimiter.
+//
+// For example, "a::b:c" split by "::" will produce []string{"a", "b:c"}.
+func GreedyStringSplit(delim, s string) []string {
+	return omitEmpty(strings.Split(s, delim))
+}
+
+// NonGreedySplit splits s along a delimiter, retaining empty slices.
+// For example, ":foo:" split by ":" will produce []string{"", "foo", ""}.
+func NonGreedySplit(delim, s string) []string {
+	return strings.Split(s, delim)
+}
+
+// RuneSplit splits s into its runes, ignoring delim.
+// For example, "añb" will produce []string{"a", "ñ", "b"}.
+func RuneSplit(_, s string) []string {
+	fields := make([]string, 0, len(s))
+	for s != "" {
+		_, n := utf8.DecodeRuneInString(s)
+		fields = append(fields, s[:n])
+		s = s[n:]
+	}
+	return fields
+}
+
+// ByteSplit splits s into its bytes, ignoring delim. Fields may not be valid
+// UTF-8, but joining a contiguous range of fields reproduces that range of s.
+// For example, "añb" will produce []string{"a", "\xc3", "\xb1", "b"}.
+func ByteSplit(_, s string) []string {
+	fields := make([]string, len(s))
+	for i := range fields {
+		fields[i] = s[i : i+1]
+	}
+	return fields
+}
+
+// GreedyRegexpSplit returns a SplitFunc that splits s along matches of rx,
+// omitting empty splits from the resulting slice. The delimiter passed to the
+// SplitFunc is ignored.
+func GreedyRegexpSplit(rx *regexp.Regexp) SplitFunc {
+	return func(_, s string) []string {
+		return omitEmpty(rx.Split(s, -1))
+	}
+}
+
+// NonGreedyRegexpSplit returns a SplitFunc that splits s along matches of rx,
+// retaining empty slices. The delimiter passed to the SplitFunc is ignored.
+func NonGreedyRegexpSplit(rx *regexp.Regexp) SplitFunc {
+	return func(_, s string) []string {
+		return rx.Split(s, -1)
+	}
+}
+
+// Columns holds the offsets, in runes, at which the columns of fixed-width
+// text begin, such as the output of ps or df. The first column begins at 0 and
+// isn't included, and the last column runs to the end of each line.
+type Columns []int
+
+// InferColumns infers the columns of fixed-width text from its header line and
+// a sample of the lines following it.
+//
+// Each run of non-space runes in the header names a column. Between two names,
+// a column begins in the middle of the longest run of positions that are
+// spaces in the header and in every line of the sample, allowing for values
+// that are wider than their names and aligned to either side. If there is no
+// such position, the names are merged into one column. A column that is blank
+// in every line of the sample is also merged into the column before it, so
+// that "Mounted on" in the header of df is one column whether or not a mount
+// point reaches past "Mounted".
+func InferColumns(header string, sample []string) Columns {
+	var (
+		hdr   = []rune(header)
+		lines = make([][]rune, len(sample))
+		cols  Columns
+	)
+	for i, line := range sample {
+		lines[i] = []rune(line)
+	}
+	blank := func(p int) bool {
+		if !unicode.IsSpace(hdr[p]) {
+			return false
+		}
+		for _, line := range lines {
+			if p < len(line) && !unicode.IsSpace(line[p]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	p := 0
+	for p < len(hdr) && unicode.IsSpace(hdr[p]) {
+		p++
+	}
+	for {
+		for p < len(hdr) && !unicode.IsSpace(hdr[p]) {
+			p++
+		}
+		gap := p
+		for p < len(hdr) && unicode.IsSpace(hdr[p]) {
+			p++
+		}
+		if p == len(hdr) {
+			return cols.mergeBlank(lines)
+		}
+
+		// Find the longest run of blank positions between the names
+		start, n := -1, 0
+		for q := gap; q < p; {
+			if !blank(q) {
+				q++
+				continue
+			}
+			r := q
+			for r < p && blank(r) {
+				r++
+			}
+			if r-q > n {
+				start, n = q, r-q
+			}
+			q = r
+		}
+		if start != -1 {
+			cols = append(cols, start+n/2)
+		}
+	}
+}
+
+// mergeBlank returns the columns without those that are blank in every line,
+// merging each into the column before it. If there are no lines, it returns
+// the columns unchanged.
+func (cols Columns) mergeBlank(lines [][]rune) Columns {
+	if len(lines) == 0 {
+		return cols
+	}
+	blank := func(start, end int) bool {
+		for _, line := range lines {
+			for p := start; p < len(line) && (end == -1 || p < end); p++ {
+				if !unicode.IsSpace(line[p]) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	var merged Columns
+	for i, start := range cols {
+		end := -1
+		if i+1 < len(cols) {
+			end = cols[i+1]
+		}
+		if !blank(start, end) {
+			merged = append(merged, start)
+		}
+	}
+	return merged
+}
+
+// Split splits s into fixed-width columns, ignoring delim, and trims spaces
+// from each field. If s is too short to reach a column, its field is empty, so
+// the number of fields is always one more than the number of offsets in c.
+func (c Columns) Split(_, s string) []string {
+	var (
+		fields = make([]string, 0, len(c)+1)
+		start  = 0 // Byte offset of the current column
+		col    = 0 // Index of the next column in c
+		i      = 0 // Rune offset
+	)
+	for off := range s {
+		if col < len(c) && i == c[col] {
+			fields = append(fields, strings.TrimSpace(s[start:off]))
+			start = off
+			col++
+		}
+		i++
+	}
+	fields = append(fields, strings.TrimSpace(s[start:]))
+	for ; col < len(c); col++ {
+		fields = append(fields, "")
+	}
+	return fields
+}
+
+// omitEmpty removes empty strings from fields, in place.
+func omitEmpty(fields []string) []string {
+	n := 0
+	for _, f := range fields {
+		if f != "" {
+			fields[n] = f
+			n++
+		}
+	}
+	return fields[:n]
+}
+
+// QuotedSplit returns a SplitFunc that splits s along a delimiter, as with
+// GreedyStringSplit (or NonGreedySplit, if greedy is false), but ignores
+// delimiters inside double or single quotes or escaped by a backslash. For
+// example, `a "b c" d\ e` split by " " will produce
+// []string{"a", `"b c"`, `d\ e`}.
+//
+// As in a shell, a backslash escapes any rune outside of single quotes, and a
+// quote may begin or end in the middle of a field. An unterminated quote runs
+// to the end of s. In greedy mode, empty fields are omitted unless they contain
+// quotes, as in `a "" b`.
+//
+// If unquote is true, quotes and escaping backslashes are removed from fields,
+// so the example above produces []string{"a", "b c", "d e"}. Otherwise, fields
+// are returned as they appear in s.
+func QuotedSplit(greedy, unquote bool) SplitFunc {
+	return func(delim, s string) []string {
+		var (
+			fields  []string
+			b       strings.Builder
+			start   int  // Byte offset of the current field
+			quote   rune // Current quote rune, or 0
+			quoted  bool // Whether the current field contains quotes
+			escaped bool
+		)
+		field := func(end int) {
+			f := s[start:end]
+			if unquote {
+				f = b.String()
+				b.Reset()
+			}
+			if !greedy || f != "" || quoted {
+				fields = append(fields, f)
+			}
+			quoted = false
+		}
+
+		for i := 0; i < len(s); {
+			r, n := utf8.DecodeRuneInString(s[i:])
+			keep := true
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\' && quote != '\'':
+				escaped, keep = true, false
+			case quote != 0:
+				if r == quote {
+					quote, keep = 0, false
+				}
+			case r == '"' || r == '\'':
+				quote, quoted, keep = r, true, false
+			case delim != "" && strings.HasPrefix(s[i:], delim):
+				field(i)
+				i += len(delim)
+				start = i
+				continue
+			}
+			if unquote && keep {
+				b.WriteString(s[i : i+n])
+			}
+			i += n
+		}
+		if escaped && unquote {
+			b.WriteByte('\\')
+		}
+		field(len(s))
+		return fields
+	}
+}
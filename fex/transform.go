@@ -0,0 +1,448 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TransformFunc transforms a value, such as the fields selected by an extract.
+type TransformFunc func(s string) (string, error)
+
+// transform is a built-in transform, which takes from minArgs to maxArgs
+// arguments.
+type transform struct {
+	minArgs, maxArgs int
+	new              func(args []string) (TransformFunc, error)
+}
+
+// transforms is the registry of built-in transforms, by name.
+var transforms = map[string]transform{
+	"upper":  {0, 0, simpleTransform(strings.ToUpper)},
+	"lower":  {0, 0, simpleTransform(strings.ToLower)},
+	"trim":   {0, 1, newTrim},
+	"length": {0, 0, simpleTransform(length)},
+	"pad":    {1, 2, newPad},
+	"time":   {1, 3, newTime},
+	"decode": {1, 1, newDecode},
+	"encode": {1, 1, newEncode},
+}
+
+// transformNames returns the names of the built-in transforms, sorted.
+func transformNames() []string {
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// simpleTransform returns the constructor of a transform without arguments
+// that cannot fail.
+func simpleTransform(fn func(string) string) func([]string) (TransformFunc, error) {
+	return func([]string) (TransformFunc, error) {
+		return func(s string) (string, error) { return fn(s), nil }, nil
+	}
+}
+
+// length returns the number of characters in s.
+func length(s string) string {
+	return strconv.Itoa(utf8.RuneCountInString(s))
+}
+
+// newTrim returns a transform removing leading and trailing white space or,
+// if given, the characters in args[0].
+func newTrim(args []string) (TransformFunc, error) {
+	if len(args) == 0 {
+		return func(s string) (string, error) { return strings.TrimSpace(s), nil }, nil
+	}
+	cutset := args[0]
+	return func(s string) (string, error) { return strings.Trim(s, cutset), nil }, nil
+}
+
+// newPad returns a transform padding values to a width of args[0] characters
+// with args[1], or spaces. Values are padded on the left, unless the width is
+// negative.
+func newPad(args []string) (TransformFunc, error) {
+	width, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("width must be an integer: %q", args[0])
+	}
+	fill := " "
+	if len(args) > 1 {
+		if utf8.RuneCountInString(args[1]) != 1 {
+			return nil, fmt.Errorf("padding must be a single character: %q", args[1])
+		}
+		fill = args[1]
+	}
+
+	left := width >= 0
+	if !left {
+		width = -width
+	}
+	return func(s string) (string, error) {
+		n := width - utf8.RuneCountInString(s)
+		if n <= 0 {
+			return s, nil
+		} else if left {
+			return strings.Repeat(fill, n) + s, nil
+		}
+		return s + strings.Repeat(fill, n), nil
+	}, nil
+}
+
+// timeLayouts are the named layouts of the time transform. The "unix" and
+// "unixms" layouts are the number of seconds or milliseconds since the Unix
+// epoch.
+var timeLayouts = map[string]string{
+	"apache":  "02/Jan/2006:15:04:05 -0700",
+	"rfc3339": time.RFC3339,
+	"unix":    "unix",
+	"unixms":  "unixms",
+}
+
+// newTime returns a transform parsing times with the layout args[0] and
+// formatting them with the layout args[1], or RFC 3339 if it's empty. Layouts
+// are Go time layouts or the names of timeLayouts.
+//
+// If args[2] is given, it's the name of a time zone, such as "UTC" or
+// "America/New_York", that times are converted to and that times without a zone
+// are assumed to be in. Otherwise, times keep their zone, and times without one
+// are in UTC.
+func newTime(args []string) (TransformFunc, error) {
+	in, out := timeLayout(args[0]), time.RFC3339
+	if in == "" {
+		return nil, errors.New("empty input layout")
+	} else if len(args) > 1 && args[1] != "" {
+		out = timeLayout(args[1])
+	}
+
+	loc, convert := time.UTC, false
+	if len(args) > 2 {
+		var err error
+		if loc, err = time.LoadLocation(args[2]); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", args[2])
+		}
+		convert = true
+	}
+
+	return func(s string) (string, error) {
+		t, err := parseTime(in, strings.TrimSpace(s), loc)
+		if err != nil {
+			return "", err
+		}
+		if convert {
+			t = t.In(loc)
+		}
+		return formatTime(out, t), nil
+	}, nil
+}
+
+// timeLayout returns the layout named name, or name if it isn't the name of
+// a layout.
+func timeLayout(name string) string {
+	if layout, ok := timeLayouts[name]; ok {
+		return layout
+	}
+	return name
+}
+
+// parseTime parses s with layout, which may be "unix" or "unixms", in loc.
+func parseTime(layout, s string, loc *time.Location) (time.Time, error) {
+	switch layout {
+	case "unix":
+		sec, frac := s, ""
+		if i := strings.IndexByte(s, '.'); i != -1 {
+			sec, frac = s[:i], s[i+1:]
+		}
+		n, err := strconv.ParseInt(sec, 10, 64)
+		if err != nil || strings.Trim(frac, "0123456789") != "" {
+			return time.Time{}, fmt.Errorf("invalid Unix time %q", s)
+		}
+		var ns int64
+		if frac != "" {
+			frac = (frac + "000000000")[:9]
+			ns, _ = strconv.ParseInt(frac, 10, 64)
+			if strings.HasPrefix(sec, "-") {
+				ns = -ns
+			}
+		}
+		return time.Unix(n, ns).In(loc), nil
+
+	case "unixms":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid Unix time in milliseconds %q", s)
+		}
+		return time.UnixMilli(n).In(loc), nil
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// formatTime formats t with layout, which may be "unix" or "unixms".
+func formatTime(layout string, t time.Time) string {
+	switch layout {
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixms":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.Format(layout)
+}
+
+// codec is an encoding of the decode and encode transforms.
+type codec struct {
+	decode func(s string) (string, error)
+	encode func(s string) string
+}
+
+// codecs are the encodings of the decode and encode transforms, by name.
+var codecs = map[string]codec{
+	"url":       {url.PathUnescape, url.PathEscape},
+	"query":     {url.QueryUnescape, url.QueryEscape},
+	"base64":    {base64Decoder(base64.RawStdEncoding), base64Encoder(base64.StdEncoding)},
+	"base64url": {base64Decoder(base64.RawURLEncoding), base64Encoder(base64.URLEncoding)},
+	"hex":       {decodeHex, encodeHex},
+	"json":      {decodeJSON, encodeJSON},
+	"html":      {decodeHTML, html.EscapeString},
+}
+
+// codecNames returns the names of the codecs, sorted.
+func codecNames() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupCodec returns the codec named name.
+func lookupCodec(name string) (codec, error) {
+	c, ok := codecs[name]
+	if !ok {
+		return codec{}, fmt.Errorf("no encoding named %q; known encodings are %s",
+			name, strings.Join(codecNames(), ", "))
+	}
+	return c, nil
+}
+
+// newDecode returns a transform decoding values with the codec args[0].
+func newDecode(args []string) (TransformFunc, error) {
+	c, err := lookupCodec(args[0])
+	if err != nil {
+		return nil, err
+	}
+	name := args[0]
+	return func(s string) (string, error) {
+		d, err := c.decode(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s %q", name, s)
+		}
+		return d, nil
+	}, nil
+}
+
+// newEncode returns a transform encoding values with the codec args[0].
+func newEncode(args []string) (TransformFunc, error) {
+	c, err := lookupCodec(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return simpleTransform(c.encode)(nil)
+}
+
+// base64Decoder returns a decoder for enc, which must not be padded, that
+// accepts values with or without padding.
+func base64Decoder(enc *base64.Encoding) func(string) (string, error) {
+	return func(s string) (string, error) {
+		b, err := enc.DecodeString(strings.TrimRight(s, "="))
+		return string(b), err
+	}
+}
+
+// base64Encoder returns an encoder for enc.
+func base64Encoder(enc *base64.Encoding) func(string) string {
+	return func(s string) string { return enc.EncodeToString([]byte(s)) }
+}
+
+// decodeHex decodes a string of hexadecimal digits.
+func decodeHex(s string) (string, error) {
+	b, err := hex.DecodeString(s)
+	return string(b), err
+}
+
+// encodeHex encodes s as lowercase hexadecimal digits.
+func encodeHex(s string) string {
+	return hex.EncodeToString([]byte(s))
+}
+
+// decodeJSON unescapes a JSON string, with or without its quotes.
+func decodeJSON(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		s = `"` + s + `"`
+	}
+	var d string
+	err := json.Unmarshal([]byte(s), &d)
+	return d, err
+}
+
+// encodeJSON escapes s as a JSON string, without its quotes, so that it can be
+// placed between quotes.
+func encodeJSON(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // Cannot fail for a string.
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(b.String()), `"`), `"`)
+}
+
+// decodeHTML unescapes HTML entities, such as "&lt;" and "&#39;".
+func decodeHTML(s string) (string, error) {
+	return html.UnescapeString(s), nil
+}
+
+// ErrorPolicy determines what a TransformFilter does with a value that it
+// fails to transform.
+type ErrorPolicy string
+
+// Error policies of a TransformFilter.
+const (
+	// FailOnError fails the selection, and so the extract, with the error.
+	FailOnError ErrorPolicy = "fail"
+	// KeepOnError passes the value through untransformed.
+	KeepOnError ErrorPolicy = "keep"
+	// EmptyOnError replaces the value with an empty string.
+	EmptyOnError ErrorPolicy = "empty"
+)
+
+func (p ErrorPolicy) String() string {
+	return string(p)
+}
+
+// onErrorPrefix begins the argument setting the error policy of a transform.
+const onErrorPrefix = "onerror="
+
+// TransformFilter is a Filter that transforms each field with a built-in
+// transform, such as "lower" or "pad". In an extract, a transform is written
+// after the selectors whose value it transforms, as in "1|lower" or
+// "2|trim([])|pad(8)", and is tokenized with NoSplit.
+type TransformFilter struct {
+	name   string
+	args   []string
+	fn     TransformFunc
+	policy ErrorPolicy
+}
+
+// NewTransformFilter returns a TransformFilter for the built-in transform
+// name with the given arguments.
+//
+// If the last argument is "onerror=" followed by an ErrorPolicy, as in
+// "onerror=keep", it sets the error policy of the filter instead of being
+// passed to the transform. The default policy is FailOnError.
+func NewTransformFilter(name string, args ...string) (*TransformFilter, error) {
+	t, ok := transforms[name]
+	if !ok {
+		return nil, fmt.Errorf("no transform named %q; known transforms are %s",
+			name, strings.Join(transformNames(), ", "))
+	}
+
+	policy := FailOnError
+	if n := len(args); n > 0 && strings.HasPrefix(args[n-1], onErrorPrefix) {
+		switch p := ErrorPolicy(args[n-1][len(onErrorPrefix):]); p {
+		case FailOnError, KeepOnError, EmptyOnError:
+			policy, args = p, args[:n-1]
+		default:
+			return nil, fmt.Errorf("%s: unknown error policy %q; must be fail, keep, or empty", name, p)
+		}
+	}
+
+	switch n := len(args); {
+	case n >= t.minArgs && n <= t.maxArgs:
+	case t.maxArgs == 0:
+		return nil, fmt.Errorf("%s takes no arguments", name)
+	case t.minArgs == 0:
+		return nil, fmt.Errorf("%s takes at most %s", name, arguments(t.maxArgs))
+	case t.minArgs == t.maxArgs:
+		return nil, fmt.Errorf("%s takes %s", name, arguments(t.minArgs))
+	default:
+		return nil, fmt.Errorf("%s takes %d to %d arguments", name, t.minArgs, t.maxArgs)
+	}
+
+	fn, err := t.new(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &TransformFilter{name: name, args: args, fn: fn, policy: policy}, nil
+}
+
+// arguments returns "n argument" or "n arguments".
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return strconv.Itoa(n) + " arguments"
+}
+
+// Name returns the name of the transform.
+func (t *TransformFilter) Name() string {
+	return t.name
+}
+
+// Args returns the arguments of the transform, not including its error
+// policy.
+func (t *TransformFilter) Args() []string {
+	return t.args
+}
+
+// Policy returns the error policy of the transform.
+func (t *TransformFilter) Policy() ErrorPolicy {
+	return t.policy
+}
+
+// Select returns the transformed fields. Fields that fail to transform are
+// handled according to the filter's error policy.
+func (t *TransformFilter) Select(fields []string, _ string) ([]string, error) {
+	out := make([]string, len(fields))
+	for i, field := range fields {
+		var err error
+		if out[i], err = t.fn(field); err == nil {
+			continue
+		}
+		switch t.policy {
+		case KeepOnError:
+			out[i] = field
+		case EmptyOnError:
+			out[i] = ""
+		default:
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+	return out, nil
+}
@@ -1 +1,3 @@
 module go.spiff.io/go-fex
+
+go 1.17
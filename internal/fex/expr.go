@@ -0,0 +1,663 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.spiff.io/go-fex/fex"
+)
+
+// expression is a condition given by --if, such as `$9 >= 500 && $1 ~ /^10\./`.
+// It's compiled to a function of the values of the extracts it refers to, as
+// $N or ${extract}, which are compiled with the other extracts of fex.
+type expression struct {
+	refs []string // Extracts referred to, each once
+	eval func(values []string) bool
+}
+
+func (e *expression) extracts() []string {
+	return e.refs
+}
+
+func (e *expression) match(values []string) bool {
+	return e.eval(values)
+}
+
+// exprError is an error at a byte offset in an expression.
+type exprError struct {
+	arg    string
+	offset int
+	msg    string
+}
+
+func (e *exprError) Error() string {
+	return fmt.Sprintf("character %d: %s", utf8.RuneCountInString(e.arg[:e.offset])+1, e.msg)
+}
+
+// Caret returns the expression followed by a line with a caret under the
+// error, as with fex.ParseError.
+func (e *exprError) Caret() string {
+	pe := &fex.ParseError{Arg: e.arg, Offset: utf8.RuneCountInString(e.arg[:e.offset])}
+	return pe.Caret()
+}
+
+// exprType is the type of a value in an expression.
+type exprType int
+
+const (
+	typeBool exprType = iota
+	typeNum
+	typeStr
+	// typeField is the type of an extract's value. It's a string that is
+	// converted to a number where one is needed. If the value isn't a number,
+	// it's converted to NaN, which is not equal to, less than, or greater than
+	// any number.
+	typeField
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeBool:
+		return "boolean"
+	case typeNum:
+		return "number"
+	}
+	return "string"
+}
+
+// operand is a compiled subexpression. Only the function for its type is set.
+// A typeField operand has a string function.
+type operand struct {
+	typ exprType
+	pos int
+	b   func([]string) bool
+	n   func([]string) float64
+	s   func([]string) string
+}
+
+// tokenKind is the kind of a token of an expression.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNum
+	tokStr
+	tokRegexp
+	tokRef
+	tokIdent
+	tokOp
+)
+
+// token is a token of an expression. Its text is the value of a literal, the
+// extract of a reference, or an operator.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokOp, tokIdent:
+		return strconv.Quote(t.text)
+	case tokRef:
+		return "extract " + strconv.Quote(t.text)
+	case tokNum:
+		return "number " + t.text
+	case tokStr:
+		return "string " + strconv.Quote(t.text)
+	}
+	return "regexp"
+}
+
+// Operators, longest first.
+var exprOps = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "!~",
+	"<", ">", "!", "~", "+", "-", "*", "/", "%", "(", ")",
+}
+
+// lexExpression splits an expression into tokens, ending with a tokEOF token.
+func lexExpression(arg string) ([]token, error) {
+	var toks []token
+	errorf := func(off int, format string, args ...interface{}) error {
+		return &exprError{arg: arg, offset: off, msg: fmt.Sprintf(format, args...)}
+	}
+	afterMatch := func() bool {
+		if len(toks) == 0 {
+			return false
+		}
+		last := toks[len(toks)-1]
+		return last.kind == tokOp && (last.text == "~" || last.text == "!~")
+	}
+
+	for i := 0; i < len(arg); {
+		r, size := utf8.DecodeRuneInString(arg[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r == '$' && strings.HasPrefix(arg[i+1:], "{"): // ${extract}
+			depth, end := 0, -1
+			for j := i + 1; j < len(arg) && end == -1; j++ {
+				switch arg[j] {
+				case '{':
+					depth++
+				case '}':
+					if depth--; depth == 0 {
+						end = j
+					}
+				}
+			}
+			if end == -1 {
+				return nil, errorf(i, "unmatched '{'")
+			} else if end == i+2 {
+				return nil, errorf(i, "empty extract")
+			}
+			toks = append(toks, token{tokRef, arg[i+2 : end], i})
+			i = end + 1
+
+		case r == '$': // $N
+			j := i + 1
+			for j < len(arg) && '0' <= arg[j] && arg[j] <= '9' {
+				j++
+			}
+			if j == i+1 {
+				return nil, errorf(i, "expected a field number or {extract} after '$'")
+			}
+			toks = append(toks, token{tokRef, arg[i+1 : j], i})
+			i = j
+
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(arg) && '0' <= arg[i+1] && arg[i+1] <= '9':
+			j := i
+			for j < len(arg) && (arg[j] == '.' || '0' <= arg[j] && arg[j] <= '9') {
+				j++
+			}
+			if j < len(arg) && (arg[j] == 'e' || arg[j] == 'E') {
+				j++
+				if j < len(arg) && (arg[j] == '+' || arg[j] == '-') {
+					j++
+				}
+				for j < len(arg) && '0' <= arg[j] && arg[j] <= '9' {
+					j++
+				}
+			}
+			if _, err := strconv.ParseFloat(arg[i:j], 64); err != nil {
+				return nil, errorf(i, "invalid number %q", arg[i:j])
+			}
+			toks = append(toks, token{tokNum, arg[i:j], i})
+			i = j
+
+		case r == '"':
+			j := i + 1
+			for j < len(arg) && arg[j] != '"' {
+				if arg[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(arg) {
+				return nil, errorf(i, "unterminated string")
+			}
+			s, err := strconv.Unquote(arg[i : j+1])
+			if err != nil {
+				return nil, errorf(i, "invalid string: %v", err)
+			}
+			toks = append(toks, token{tokStr, s, i})
+			i = j + 1
+
+		case r == '/' && afterMatch(): // Regexp, only after ~ or !~
+			j := i + 1
+			for j < len(arg) && arg[j] != '/' {
+				if arg[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(arg) {
+				return nil, errorf(i, "unterminated regexp")
+			}
+			rx := strings.Replace(arg[i+1:j], `\/`, "/", -1)
+			toks = append(toks, token{tokRegexp, rx, i})
+			i = j + 1
+
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(arg) {
+				r, size := utf8.DecodeRuneInString(arg[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			toks = append(toks, token{tokIdent, arg[i:j], i})
+			i = j
+
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(arg[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorf(i, "unexpected character %q", r)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(arg)}), nil
+}
+
+// exprParser compiles the tokens of an expression. Expressions are parsed by
+// recursive descent, from the operators of lowest precedence to the highest:
+//
+//	||
+//	&&
+//	== != < <= > >= ~ !~
+//	+ -
+//	* / %
+//	! - (unary)
+type exprParser struct {
+	arg   string
+	toks  []token
+	refs  []string
+	index map[string]int // Index of each extract in refs
+}
+
+// parseExpression parses and type-checks an expression, which must be
+// a boolean.
+func parseExpression(arg string) (*expression, error) {
+	toks, err := lexExpression(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{arg: arg, toks: toks, index: map[string]int{}}
+	o, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t.pos, "unexpected %v", t)
+	}
+	eval, err := p.bool(o)
+	if err != nil {
+		return nil, err
+	}
+	return &expression{refs: p.refs, eval: eval}, nil
+}
+
+func (p *exprParser) errorf(off int, format string, args ...interface{}) error {
+	return &exprError{arg: p.arg, offset: off, msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) peek() token {
+	return p.toks[0]
+}
+
+func (p *exprParser) next() token {
+	t := p.toks[0]
+	if t.kind != tokEOF {
+		p.toks = p.toks[1:]
+	}
+	return t
+}
+
+// op returns the next token if it's one of the operators in ops.
+func (p *exprParser) op(ops ...string) (token, bool) {
+	if t := p.peek(); t.kind == tokOp {
+		for _, op := range ops {
+			if t.text == op {
+				return p.next(), true
+			}
+		}
+	}
+	return token{}, false
+}
+
+// bool returns the function of o, which must be a boolean.
+func (p *exprParser) bool(o operand) (func([]string) bool, error) {
+	if o.typ != typeBool {
+		return nil, p.errorf(o.pos, "expected a boolean, found a %v", o.typ)
+	}
+	return o.b, nil
+}
+
+// num returns the function of o, which must be a number or an extract's
+// value.
+func (p *exprParser) num(o operand) (func([]string) float64, error) {
+	switch o.typ {
+	case typeNum:
+		return o.n, nil
+	case typeField:
+		s := o.s
+		return func(v []string) float64 { return toNumber(s(v)) }, nil
+	}
+	return nil, p.errorf(o.pos, "expected a number, found a %v", o.typ)
+}
+
+// str returns the function of o, which must be a string or an extract's
+// value.
+func (p *exprParser) str(o operand) (func([]string) string, error) {
+	if o.typ != typeStr && o.typ != typeField {
+		return nil, p.errorf(o.pos, "expected a string, found a %v", o.typ)
+	}
+	return o.s, nil
+}
+
+// toNumber returns s as a number, or NaN if it isn't one.
+func toNumber(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func (p *exprParser) or() (operand, error) {
+	return p.logical("||", p.and)
+}
+
+func (p *exprParser) and() (operand, error) {
+	return p.logical("&&", p.comparison)
+}
+
+// logical parses a sequence of operands, parsed by next, joined by op, which
+// is && or ||.
+func (p *exprParser) logical(op string, next func() (operand, error)) (operand, error) {
+	l, err := next()
+	if err != nil {
+		return l, err
+	}
+	for {
+		if _, ok := p.op(op); !ok {
+			return l, nil
+		}
+		r, err := next()
+		if err != nil {
+			return r, err
+		}
+		lb, err := p.bool(l)
+		if err != nil {
+			return l, err
+		}
+		rb, err := p.bool(r)
+		if err != nil {
+			return r, err
+		}
+		if op == "&&" {
+			l.b = func(v []string) bool { return lb(v) && rb(v) }
+		} else {
+			l.b = func(v []string) bool { return lb(v) || rb(v) }
+		}
+	}
+}
+
+func (p *exprParser) comparison() (operand, error) {
+	l, err := p.additive()
+	if err != nil {
+		return l, err
+	}
+	t, ok := p.op("==", "!=", "<", "<=", ">", ">=", "~", "!~")
+	if !ok {
+		return l, nil
+	}
+	if t.text == "~" || t.text == "!~" {
+		return p.match(l, t)
+	}
+
+	r, err := p.additive()
+	if err != nil {
+		return r, err
+	}
+	o := operand{typ: typeBool, pos: l.pos}
+	switch {
+	case l.typ == typeBool || r.typ == typeBool:
+		if l.typ != r.typ {
+			return o, p.errorf(t.pos, "cannot compare a %v and a %v", l.typ, r.typ)
+		} else if t.text != "==" && t.text != "!=" {
+			return o, p.errorf(t.pos, "booleans can only be compared with == and !=")
+		}
+		lb, rb, eq := l.b, r.b, t.text == "=="
+		o.b = func(v []string) bool { return (lb(v) == rb(v)) == eq }
+
+	case l.typ == typeNum || r.typ == typeNum:
+		ln, err := p.num(l)
+		if err != nil {
+			return o, err
+		}
+		rn, err := p.num(r)
+		if err != nil {
+			return o, err
+		}
+		o.b = compareNum(t.text, ln, rn)
+
+	case l.typ == typeField && r.typ == typeField:
+		o.b = compareField(t.text, l.s, r.s)
+
+	default:
+		o.b = compareStr(t.text, l.s, r.s)
+	}
+	return o, nil
+}
+
+// match parses the regexp following the ~ or !~ operator, op, whose left
+// operand is l. The regexp is either /regexp/ or a string.
+func (p *exprParser) match(l operand, op token) (operand, error) {
+	ls, err := p.str(l)
+	if err != nil {
+		return l, err
+	}
+	t := p.next()
+	if t.kind != tokRegexp && t.kind != tokStr {
+		return l, p.errorf(t.pos, "expected a regexp after %q, found %v", op.text, t)
+	}
+	rx, err := regexp.Compile(t.text)
+	if err != nil {
+		return l, p.errorf(t.pos, "invalid regexp: %v", err)
+	}
+	want := op.text == "~"
+	return operand{
+		typ: typeBool,
+		pos: l.pos,
+		b:   func(v []string) bool { return rx.MatchString(ls(v)) == want },
+	}, nil
+}
+
+// compareNum returns a function comparing numbers with the operator op.
+func compareNum(op string, l, r func([]string) float64) func([]string) bool {
+	switch op {
+	case "==":
+		return func(v []string) bool { return l(v) == r(v) }
+	case "!=":
+		return func(v []string) bool { return l(v) != r(v) }
+	case "<":
+		return func(v []string) bool { return l(v) < r(v) }
+	case "<=":
+		return func(v []string) bool { return l(v) <= r(v) }
+	case ">":
+		return func(v []string) bool { return l(v) > r(v) }
+	default: // >=
+		return func(v []string) bool { return l(v) >= r(v) }
+	}
+}
+
+// compareField returns a function comparing the values of two extracts with
+// the operator op. As in awk, they're compared as numbers if both are numbers,
+// and as strings otherwise.
+func compareField(op string, l, r func([]string) string) func([]string) bool {
+	num := compareNum(op,
+		func(v []string) float64 { return toNumber(v[0]) },
+		func(v []string) float64 { return toNumber(v[1]) })
+	str := compareStr(op,
+		func(v []string) string { return v[0] },
+		func(v []string) string { return v[1] })
+	return func(v []string) bool {
+		pair := []string{l(v), r(v)}
+		if math.IsNaN(toNumber(pair[0])) || math.IsNaN(toNumber(pair[1])) {
+			return str(pair)
+		}
+		return num(pair)
+	}
+}
+
+// compareStr returns a function comparing strings with the operator op.
+func compareStr(op string, l, r func([]string) string) func([]string) bool {
+	switch op {
+	case "==":
+		return func(v []string) bool { return l(v) == r(v) }
+	case "!=":
+		return func(v []string) bool { return l(v) != r(v) }
+	case "<":
+		return func(v []string) bool { return l(v) < r(v) }
+	case "<=":
+		return func(v []string) bool { return l(v) <= r(v) }
+	case ">":
+		return func(v []string) bool { return l(v) > r(v) }
+	default: // >=
+		return func(v []string) bool { return l(v) >= r(v) }
+	}
+}
+
+func (p *exprParser) additive() (operand, error) {
+	return p.arithmetic(p.multiplicative, "+", "-")
+}
+
+func (p *exprParser) multiplicative() (operand, error) {
+	return p.arithmetic(p.unary, "*", "/", "%")
+}
+
+// arithmetic parses a sequence of numbers, parsed by next, joined by ops.
+func (p *exprParser) arithmetic(next func() (operand, error), ops ...string) (operand, error) {
+	l, err := next()
+	if err != nil {
+		return l, err
+	}
+	for {
+		t, ok := p.op(ops...)
+		if !ok {
+			return l, nil
+		}
+		r, err := next()
+		if err != nil {
+			return r, err
+		}
+		ln, err := p.num(l)
+		if err != nil {
+			return l, err
+		}
+		rn, err := p.num(r)
+		if err != nil {
+			return r, err
+		}
+
+		l = operand{typ: typeNum, pos: l.pos}
+		switch t.text {
+		case "+":
+			l.n = func(v []string) float64 { return ln(v) + rn(v) }
+		case "-":
+			l.n = func(v []string) float64 { return ln(v) - rn(v) }
+		case "*":
+			l.n = func(v []string) float64 { return ln(v) * rn(v) }
+		case "/":
+			l.n = func(v []string) float64 { return ln(v) / rn(v) }
+		case "%":
+			l.n = func(v []string) float64 { return math.Mod(ln(v), rn(v)) }
+		}
+	}
+}
+
+func (p *exprParser) unary() (operand, error) {
+	t, ok := p.op("!", "-")
+	if !ok {
+		return p.primary()
+	}
+	o, err := p.unary()
+	if err != nil {
+		return o, err
+	}
+	if t.text == "!" {
+		b, err := p.bool(o)
+		if err != nil {
+			return o, err
+		}
+		return operand{typ: typeBool, pos: t.pos, b: func(v []string) bool { return !b(v) }}, nil
+	}
+	n, err := p.num(o)
+	if err != nil {
+		return o, err
+	}
+	return operand{typ: typeNum, pos: t.pos, n: func(v []string) float64 { return -n(v) }}, nil
+}
+
+func (p *exprParser) primary() (operand, error) {
+	t := p.next()
+	o := operand{pos: t.pos}
+	switch t.kind {
+	case tokNum:
+		f, _ := strconv.ParseFloat(t.text, 64)
+		o.typ, o.n = typeNum, func([]string) float64 { return f }
+
+	case tokStr:
+		s := t.text
+		o.typ, o.s = typeStr, func([]string) string { return s }
+
+	case tokRef:
+		i, ok := p.index[t.text]
+		if !ok {
+			i = len(p.refs)
+			p.index[t.text] = i
+			p.refs = append(p.refs, t.text)
+		}
+		o.typ, o.s = typeField, func(v []string) string { return v[i] }
+
+	case tokIdent:
+		if t.text != "true" && t.text != "false" {
+			return o, p.errorf(t.pos, "unknown name %q", t.text)
+		}
+		b := t.text == "true"
+		o.typ, o.b = typeBool, func([]string) bool { return b }
+
+	case tokOp:
+		if t.text != "(" {
+			return o, p.errorf(t.pos, "unexpected %v", t)
+		}
+		inner, err := p.or()
+		if err != nil {
+			return inner, err
+		}
+		if c := p.next(); c.kind != tokOp || c.text != ")" {
+			return o, p.errorf(c.pos, "expected ')', found %v", c)
+		}
+		inner.pos = t.pos
+		return inner, nil
+
+	default:
+		return o, p.errorf(t.pos, "unexpected %v", t)
+	}
+	return o, nil
+}
@@ -13,19 +13,26 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package fex implements the fex command-line program on top of the public
+// go.spiff.io/go-fex/fex package.
 package fex
 
 // NOTE: This source file borrows heavily from the original fex.c, including the
 // general structure and semantics of the program.
 
 import (
-	"bufio"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
-	"regexp"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"unicode"
+
+	"go.spiff.io/go-fex/fex"
 )
 
 // Fex holds main program state for fex, including the program name (used to
@@ -58,491 +65,356 @@ func (f *Fex) Run(argv []string) int {
 		return 0
 	}
 
+	var opts options
+	argv, err := opts.parseArgs(argv)
+	if err != nil {
+		f.errorf("Error parsing options: %v", err)
+		return 2
+	}
+	if len(argv) == 0 {
+		f.Usage()
+		return 2
+	}
+
 	var (
-		rd  = bufio.NewReader(f.Stdin)
-		ops = make([]Extractor, len(argv))
+		ops    = make([]fex.Extractor, len(argv))
+		labels = make([]string, len(argv))
+		names  = make([]string, len(argv))
+		seen   = map[string]bool{"filename": opts.filename, "line": opts.lineNumber}
+		preds  []predicate
 	)
 
 	// Parse extractors
 	for i, arg := range argv {
-		op, err := CompileExtractor(arg)
-		if err != nil {
-			f.errorf("Error parsing extract %d: %q: %v", i+1, arg, err)
+		var extract string
+		labels[i] = fmt.Sprintf("extract %d: %q", i+1, arg)
+		names[i], extract = splitName(arg)
+		if seen[names[i]] {
+			f.errorf("Error parsing %s: duplicate name %q", labels[i], names[i])
+			return 1
+		} else if names[i] != "" {
+			seen[names[i]] = true
+		}
+
+		if ops[i], err = f.compile(labels[i], extract, opts.delimiter()); err != nil {
 			return 1
 		}
-		ops[i] = op
 	}
 
-	// Run all lines through extractors
-	for {
-		line, ioerr := rd.ReadString('\n')
-		if line == "" && ioerr == io.EOF {
-			break
-		} else if ioerr != nil && ioerr != io.EOF {
-			f.errorf("IO error: %v", ioerr)
+	// Parse predicates, whose extracts follow the others in ops
+	for _, arg := range opts.where {
+		c, err := parseCondition(arg)
+		if err != nil {
+			f.errorf("Error parsing --where %q: %v", arg, err)
+			return 1
+		}
+		preds, labels = append(preds, c), append(labels, fmt.Sprintf("--where %q", arg))
+	}
+	for _, arg := range opts.cond {
+		e, err := parseExpression(arg)
+		if err != nil {
+			f.errorf("Error parsing --if %q: %v", arg, err)
+			if ee, ok := err.(*exprError); ok {
+				f.errorf("%s", indent(ee.Caret(), "    "))
+			}
+			return 1
 		}
-		if err := f.processLine(line, ops); err != nil {
-			f.errorf("%v", err)
+		preds = append(preds, e)
+		for _, ref := range e.refs {
+			labels = append(labels, fmt.Sprintf("--if %q: extract %q", arg, ref))
 		}
-		if ioerr == io.EOF {
-			break
+	}
+	for _, p := range preds {
+		for _, extract := range p.extracts() {
+			op, err := f.compile(labels[len(ops)], extract, opts.delimiter())
+			if err != nil {
+				return 1
+			}
+			ops = append(ops, op)
 		}
 	}
 
-	return 0
-}
+	// Without a header, extracts can't refer to columns by name
+	if !opts.header {
+		if ops, err = f.resolve("", labels, ops, nil); err != nil {
+			return 1
+		}
+	}
 
-// Usage writes formatted usage text to stderr.
-func (f *Fex) Usage() {
-	f.errorf(usageFormat, f.Name)
-}
+	// File names and record numbers are written as leading columns
+	cols, colNames := argv, names
+	if opts.lineNumber {
+		cols, colNames = append([]string{"line"}, cols...), append([]string{""}, colNames...)
+	}
+	if opts.filename {
+		cols, colNames = append([]string{"filename"}, cols...), append([]string{""}, colNames...)
+	}
+	out, err := opts.writer(f.Stdout, colNames, cols)
+	if err != nil {
+		f.errorf("Error parsing options: %v", err)
+		return 2
+	}
 
-func (f *Fex) processLine(line string, ops []Extractor) error {
-	line = strings.TrimSuffix(line, "\n")
-	line = strings.TrimSuffix(line, "\r")
-	written := 0
-	for i, op := range ops {
-		field, err := op.Extract(line)
-		if err != nil {
-			return err
-		}
-		if i > 0 {
-			written += f.write(" ")
+	x := &extraction{
+		opts:     &opts,
+		labels:   labels,
+		ops:      ops,
+		extracts: len(argv),
+		preds:    preds,
+		out:      out,
+	}
+	status := 0
+	if len(opts.files) == 0 && !x.readInput(f, "-", f.Stdin, false) {
+		status = 1
+	}
+	for _, name := range opts.files {
+		if !x.readFile(f, name) {
+			status = 1
 		}
-		written += f.write(field)
 	}
-	if written > 0 {
-		f.write("\n")
+
+	if err := out.Close(); err != nil {
+		f.errorf("IO error: %v", err)
+		status = 1
 	}
-	return nil
+	return status
 }
 
-func (f *Fex) errorf(format string, args ...interface{}) {
-	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintln(f.Stderr, msg)
+// extraction holds the extracts of a run of fex and the output they're
+// written to.
+type extraction struct {
+	opts   *options
+	labels []string        // Labels of ops for errors
+	ops    []fex.Extractor // Resolved against each input's header, if any
+
+	// extracts is the number of ops that are extracts. The rest are the
+	// extracts of preds.
+	extracts int
+	preds    []predicate
+	out      outputWriter
 }
 
-func (f *Fex) write(s string) (n int) {
-	if s != "" {
-		n, _ = io.WriteString(f.Stdout, s)
+// readFile reads the named file, or standard input if name is "-". If name is
+// a directory, the regular files in it and its subdirectories are read in
+// lexical order. Errors are written to f's stderr, and readFile returns false
+// if any input couldn't be read.
+func (x *extraction) readFile(f *Fex, name string) bool {
+	if name == "-" {
+		return x.readInput(f, name, f.Stdin, true)
 	}
-	return n
-}
 
-// Extractor is a sequence of selectors, used to progressively select pieces of
-// text.
-type Extractor []Selector
+	info, err := os.Stat(name)
+	if err != nil {
+		f.errorf("IO error: %v", err)
+		return false
+	} else if !info.IsDir() {
+		return x.open(f, name)
+	}
 
-// Extract tokenizes and extracts fields from s, returning either a new string
-// or an error.
-func (e Extractor) Extract(s string) (result string, err error) {
-	result = s
-	for _, ex := range e {
-		result, err = ex.Extract(result)
+	ok := true
+	_ = filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return "", err
+			f.errorf("IO error: %v", err)
+			ok = false
+		} else if d.Type().IsRegular() && !x.open(f, path) {
+			ok = false
 		}
-	}
-	return result, nil
-}
-
-// Selector is an individual part of an extraction string, such as "N",
-// "_{?N:M}", or " /Rx/".  A selector tokenizes a string, filters the tokens,
-// and returns a new string based on its delimiter.
-type Selector struct {
-	delim    string
-	tokenize func(delim, s string) []string
-	filter   Filter
+		return nil
+	})
+	return ok
 }
 
-func (sel *Selector) Extract(s string) (string, error) {
-	fields := sel.tokenize(sel.delim, s)
-	fields, err := sel.filter.Select(fields, s)
+// open reads the named file with readInput.
+func (x *extraction) open(f *Fex, name string) bool {
+	file, err := os.Open(name)
 	if err != nil {
-		return "", err
+		f.errorf("IO error: %v", err)
+		return false
 	}
-	return strings.Join(fields, sel.delim), nil
+	defer file.Close()
+	return x.readInput(f, name, file, true)
 }
 
-func CompileExtractor(arg string) (Extractor, error) {
+// readInput writes the values extracted from the records of r, named name, to
+// x.out. If named is true, errors are prefixed with name. It returns false if
+// r couldn't be read or its header couldn't be resolved.
+func (x *extraction) readInput(f *Fex, name string, r io.Reader, named bool) bool {
 	var (
-		ex   Extractor
-		sr   = []rune(arg)
-		offs = make([]int, len(sr)+1)
-		n    = len(sr)
-		i    = n - 1
+		rd     = x.opts.reader(r)
+		ops    = x.ops
+		header = x.opts.header
+		origin string
+		n      int
 	)
-
-	{ // Compute string offsets of runes
-		i := 0
-		for off := range arg {
-			offs[i] = off
-			i++
-		}
-		// Could omit zeroeth index here but not worth it
-		offs[i] = len(arg)
+	if named {
+		origin = name + ": "
 	}
 
-	// Functions for working with the input argument
-	var (
-		slice = func(i, j int) string {
-			return arg[offs[i]:offs[j]]
+	for {
+		rec, err := rd.ReadRecord()
+		if err == io.EOF {
+			return true
 		}
-		find = func(r rune) int {
-			for q := i - 1; q >= 0; q-- {
-				if sr[q] == r {
-					return q
-				}
-			}
-			return -1
+		n++
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			f.errorf("%sCSV error: %v", origin, err)
+			continue
+		} else if err != nil {
+			f.errorf("%sIO error: %v", origin, err)
+			return false
 		}
-		findf = func(f func(r rune) bool) int {
-			for q := i - 1; q >= 0; q-- {
-				if f(sr[q]) {
-					return q
-				}
+		if header {
+			if ops, err = f.resolve(origin, x.labels, x.ops, &rec); err != nil {
+				return false
 			}
-			return -1
+			header = false
+			continue
 		}
-	)
-
-	// Walk rune sequence
-	for ; i >= 0; i-- {
-		var (
-			r         = sr[i]
-			tokenizer = GreedySplit
-			filter    Filter
-			err       error
-		)
-
-		switch {
-		case r == '}': // group selector
-			start := find('{')
-			if start == -1 {
-				return nil, fmt.Errorf("extractor has unmatched '}' at character %d", i+1)
-			}
-			sub := slice(start+1, i)
-			if len(sub) > 0 && sub[0] == '?' {
-				tokenizer = NonGreedySplit
-				sub = sub[1:]
-			}
-
-			var group Group
-			group, err = ParseGroup(sub)
-			if err != nil {
-				return nil, err
-			}
-			filter = group
-			i = start - 1
-
-		case r == '/': // regexp selector
-			var chunks []string
-			start := find('/')
-			for ; start != -1; start = find('/') {
-				if chunk := slice(start+1, i); chunk != "" {
-					chunks = append(chunks, chunk)
-				}
-				i = start
-
-				escaped := start > 1 && sr[start-1] == '\\'
-				if !escaped {
-					i--
-					break
-				}
-				i = findf(func(r rune) bool { return r != '\\' }) + 1
-				escapes := start - i
-				if escapes%2 == 0 {
-					// Not escaped -- delimiter is a backslash
-					break
-				}
-				chunks = append(chunks, slice(start-(escapes-1)/2, start+1))
-			}
-
-			reverseStrings(chunks)
-			rx := strings.Join(chunks, "")
-
-			filter, err = NewRegexpFilter(rx)
-			if err != nil {
-				return nil, err
-			}
-
-		case unicode.IsDigit(r): // Simple selector
-			start := findf(func(r rune) bool { return !unicode.IsDigit(r) })
-			if start > -1 && sr[start] == '-' {
-				start--
-			}
-			digits := slice(start+1, i+1)
-			var fr FieldRange
-			fr, err = ParseFieldRange(digits)
-			if err != nil {
-				return nil, err
-			}
-			filter = fr
-			i = start
 
-		default:
-			return nil, fmt.Errorf("unexpected %q in selector", r)
+		if ok, err := x.match(rec, ops); err != nil {
+			f.errorf("%s%v", origin, err)
+			continue
+		} else if !ok {
+			continue
 		}
 
-		sep := " "
-		if i > 0 && sr[i-1] == '\\' {
-			switch sr[i] {
-			case '\\':
-				sep = "\\"
-			case 'a':
-				sep = "\a"
-			case 'b':
-				sep = "\b"
-			case 'f':
-				sep = "\f"
-			case 'n':
-				sep = "\n"
-			case 'r':
-				sep = "\r"
-			case 't':
-				sep = "\t"
-			case 'v':
-				sep = "\v"
-			case 'z':
-				sep = "\x00"
-			case 'e':
-				sep = "\x1B"
-			default:
-				sep = slice(i, i+1)
-			}
-			i--
-		} else if i >= 0 {
-			sep = slice(i, i+1)
+		var prefix []string
+		if x.opts.filename {
+			prefix = append(prefix, name)
 		}
-
-		ex = append(ex, Selector{
-			delim:    sep,
-			tokenize: tokenizer,
-			filter:   filter,
-		})
-	}
-
-	for j := len(ex)/2 - 1; j >= 0; j-- {
-		opp := len(ex) - 1 - j
-		ex[j], ex[opp] = ex[opp], ex[j]
-	}
-
-	return ex, nil
-}
-
-// Filter selects a subset of fields plus the zero string to extract from the
-// input. For selectors that can return the original string, the zero string is
-// provided.
-type Filter interface {
-	Select(fields []string, zero string) ([]string, error)
-}
-
-// Group is a collection of field ranges, such as {1} or {1,4:5} or {-2:-1}.
-// It is not responsible for distinguishing between greedy and non-greedy
-// groupings.
-type Group []FieldRange
-
-func (g Group) Select(fields []string, zero string) ([]string, error) {
-	fs := make([]string, 0, 4)
-	for _, fr := range g {
-		selected, err := fr.Select(fields, zero)
-		if err != nil {
-			return nil, err
+		if x.opts.lineNumber {
+			prefix = append(prefix, strconv.Itoa(n))
 		}
-		fs = append(fs, selected...)
-	}
-	return fs, nil
-}
-
-func ParseGroup(s string) (Group, error) {
-	specs := strings.Split(s, ",")
-	g := make(Group, len(specs))
-	for i, spec := range specs {
-		fr, err := ParseFieldRange(spec)
-		if err != nil {
-			return nil, fmt.Errorf("cannot parse %q: %v", spec, err)
+		if err := f.processRecord(rec, ops[:x.extracts], prefix, x.out, x.opts.output == outputPlain); err != nil {
+			f.errorf("%s%v", origin, err)
 		}
-		g[i] = fr
 	}
-	return g, nil
 }
 
-// FieldRange is an inclusive range of [Start, End], where indices at Start
-// begin with 1.  A FieldRange with a negative start or end (or both) is
-// considered relative, and cannot be considered valid until an absolute
-// FieldRange has been created using abs.
-//
-// The empty FieldRange refers to {0:0}, {0}, or just 0 as a field index
-// (meaning the original string).
-type FieldRange struct {
-	Start   int
-	End     int
-	Reverse bool
-}
-
-func ParseFieldRange(s string) (FieldRange, error) {
-	const reversePrefix = "<"
-
-	reverse := strings.HasPrefix(s, reversePrefix)
-	if reverse {
-		s = s[len(reversePrefix):]
-	}
-
-	n := strings.IndexByte(s, ':')
-	if n == -1 {
-		i, err := strconv.Atoi(s)
-		if err != nil {
-			return FieldRange{}, err
+// match returns whether rec matches all of x's predicates, using their
+// extracts in ops. With --invert, it returns whether rec doesn't.
+func (x *extraction) match(rec record, ops []fex.Extractor) (bool, error) {
+	ops = ops[x.extracts:]
+	for _, p := range x.preds {
+		values := make([]string, len(p.extracts()))
+		for i := range values {
+			var err error
+			if values[i], err = extractRecord(ops[i], rec); err != nil {
+				return false, err
+			}
 		}
-		return FieldRange{Start: i, End: i}, nil
-	}
-
-	var (
-		start, end = s[:n], s[n+1:]
-		err        error
-		f          = FieldRange{Reverse: reverse}
-	)
-
-	if start == "" && end == "" {
-		if reverse {
-			f.Start, f.End = 1, -1
+		ops = ops[len(values):]
+		if !p.match(values) {
+			return x.opts.invert, nil
 		}
-		return f, nil
-	} else if start == "" {
-		f.Start = 1
-	} else if f.Start, err = strconv.Atoi(start); err != nil {
-		return FieldRange{}, err
-	}
-
-	if end == "" {
-		f.End = -1
-	} else if f.End, err = strconv.Atoi(end); err != nil {
-		return FieldRange{}, err
 	}
-
-	if f.Start > f.End && ((f.Start < 0 && f.End < 0) || (f.Start > 0 && f.End > 0)) {
-		return FieldRange{},
-			fmt.Errorf("start > end is invalid: %d > %d", f.Start, f.End)
-	} else if (f.Start == 0 || f.End == 0) && f.Start != f.End {
-		return FieldRange{},
-			fmt.Errorf("start or end cannot be 0 when the other is not 0: %d and %d", f.Start, f.End)
-	}
-
-	return f, err
+	return !x.opts.invert, nil
 }
 
-func (r FieldRange) Select(fields []string, zero string) ([]string, error) {
-	if r.Start == 0 && r.End == 0 {
-		return []string{zero}, nil
-	}
-
-	r = r.abs(fields)
-	if !r.isValid() {
-		return nil, nil
-	}
-
-	start, end := r.Start-1, r.End // [start, end)
-	if n := len(fields); start > n {
-		return nil, nil
-	} else if end > n {
-		end = n
-	}
-	fs := make([]string, end-start)
-	copy(fs, fields[start:])
-	if r.Reverse {
-		reverseStrings(fs)
+// splitName splits a named extract, name=extract, into its name and extract.
+// The name must be an identifier: a letter or underscore followed by letters,
+// digits, and underscores. If arg isn't named, name is "".
+func splitName(arg string) (name, extract string) {
+	for i, r := range arg {
+		switch {
+		case r == '=' && i > 0:
+			return arg[:i], arg[i+1:]
+		case r == '_' || unicode.IsLetter(r):
+		case unicode.IsDigit(r) && i > 0:
+		default:
+			return "", arg
+		}
 	}
-	return fs, nil
+	return "", arg
 }
 
-func (r FieldRange) abs(fields []string) FieldRange {
-	n := len(fields)
-	r.Start = abs(r.Start, n)
-	r.End = abs(r.End, n)
-	if r.End < r.Start {
-		r.End = r.Start
+// compile compiles extract, written to stderr as label in errors.
+func (f *Fex) compile(label, extract, delim string) (fex.Extractor, error) {
+	op, err := fex.CompileExtractorDelim(extract, delim)
+	if err != nil {
+		f.errorf("Error parsing %s: %v", label, err)
+		var pe *fex.ParseError
+		if errors.As(err, &pe) {
+			f.errorf("%s", indent(pe.Caret(), "    "))
+		}
 	}
-	return r
-}
-
-// isValid returns whether a FieldRange is valid.
-// A FieldRange with negative or zero'd offsets is not valid.
-func (r FieldRange) isValid() bool {
-	return r.Start > 0 && r.End > 0 && r.Start <= r.End
+	return op, err
 }
 
-// RegexpFilter selects fields matching its regular expression.
-// Unlike fex proper, this uses Go's RE2 regular expressions, so it's not
-// promised to be backwards compatible.
-type RegexpFilter regexp.Regexp
-
-func NewRegexpFilter(s string) (*RegexpFilter, error) {
+// resolve resolves column names in ops against the header record, hdr, or
+// checks that there are none if hdr is nil. Unless input is read as CSV, each
+// extract splits the header with its first selector. Errors are written to
+// stderr, prefixed with origin and the label of the extract.
+func (f *Fex) resolve(origin string, labels []string, ops []fex.Extractor, hdr *record) ([]fex.Extractor, error) {
+	resolved := make([]fex.Extractor, len(ops))
+	for i, op := range ops {
+		var header []string
+		switch {
+		case hdr == nil:
+		case hdr.fields != nil:
+			header = hdr.fields
+		case len(op) > 0:
+			header = op[0].Split(hdr.line)
+		}
 
-	rx, err := regexp.Compile(s)
-	if err != nil {
-		return nil, err
+		var err error
+		resolved[i], err = op.Resolve(header)
+		if errors.Is(err, fex.ErrNoHeader) {
+			err = fmt.Errorf("%w (column names require -H)", err)
+		}
+		if err != nil {
+			f.errorf("%sError in %s: %v", origin, labels[i], err)
+			return nil, err
+		}
 	}
-	return (*RegexpFilter)(rx), nil
+	return resolved, nil
 }
 
-func (r *RegexpFilter) regexp() *regexp.Regexp {
-	return (*regexp.Regexp)(r)
+// Usage writes formatted usage text to stderr.
+func (f *Fex) Usage() {
+	f.errorf(usageFormat, f.Name)
 }
 
-func (r *RegexpFilter) Select(fields []string, _ string) ([]string, error) {
-	rx := r.regexp()
-	fs := make([]string, 0, len(fields))
-	for _, f := range fields {
-		if rx.MatchString(f) {
-			fs = append(fs, f)
+// processRecord writes prefix and the values extracted from rec by ops to out.
+// If skipEmpty is true, as it is for plain output, a record is skipped if there
+// is only one extract and its value is empty. Other formats write every record,
+// so that their records line up with the input.
+func (f *Fex) processRecord(rec record, ops []fex.Extractor, prefix []string, out outputWriter, skipEmpty bool) error {
+	values := make([]string, len(ops))
+	for i, op := range ops {
+		var err error
+		if values[i], err = extractRecord(op, rec); err != nil {
+			return err
 		}
 	}
-	return fs, nil
+	if skipEmpty && len(values) == 1 && values[0] == "" {
+		return nil
+	}
+	return out.WriteRecord(append(prefix, values...))
 }
 
-// Split functions
-
-type splitFunc func(delim, s string) []string
-
-// greedySplit splits s along a delimiter, omitting empty splits from the
-// resulting slice.
-//
-// For example, ":foo:" split by ":" will produce []string{"foo"}.
-// This can result in empty slices.
-func GreedySplit(delim, s string) []string {
-	fn := func(r rune) bool {
-		for _, dr := range delim {
-			if r == dr {
-				return true
-			}
-		}
-		return false
+// extractRecord returns the value extracted from rec by op.
+func extractRecord(op fex.Extractor, rec record) (string, error) {
+	if rec.fields != nil {
+		return op.ExtractFields(rec.fields, rec.line)
 	}
-	return strings.FieldsFunc(s, fn)
+	return op.Extract(rec.line)
 }
 
-// nonGreedySplit splits s along a delimiter, retaining empty slices.
-// For example, ":foo:" split by ":" will produce []string{"", "foo", ""}.
-func NonGreedySplit(delim, s string) []string {
-	return strings.Split(s, delim)
+func (f *Fex) errorf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprintln(f.Stderr, msg)
 }
 
-// Utility functions
-
-// abs returns an offset relative to a range [1, length].
-// Negative rel values are offsets from the end of a sequence, going down.
-// Positive (including zero) rel values are offsets from the start of
-// a sequence, going up. The result is not bounds-checked.
-func abs(rel, length int) int {
-	if rel < 0 {
-		rel = length + 1 + rel
-	}
-	return rel
+// indent prefixes each line of s with prefix.
+func indent(s, prefix string) string {
+	return prefix + strings.Replace(s, "\n", "\n"+prefix, -1)
 }
 
-func reverseStrings(s []string) {
-	for j := len(s)/2 - 1; j >= 0; j-- {
-		opp := len(s) - 1 - j
-		s[j], s[opp] = s[opp], s[j]
+func (f *Fex) write(s string) (n int) {
+	if s != "" {
+		n, _ = io.WriteString(f.Stdout, s)
 	}
+	return n
 }
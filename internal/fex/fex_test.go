@@ -207,6 +207,60 @@ var testCases = map[string]*TestCase{
 		),
 	},
 
+	"StepRange": &TestCase{
+		Args: []string{`{::2}`, `{2::3}`, `{2:6:2}`, `{-3::2}`},
+		Input: wantLines(
+			`a b c d e f g`,
+		),
+		Want: wantLines(
+			`a c e g b e b d f e g`,
+		),
+	},
+
+	"NegativeStepRange": &TestCase{
+		Args: []string{`{::-1}`, `{1:6:-2}`, `{:-2:-3}`, `{2:100:-2}`},
+		Input: wantLines(
+			`a b c d e f g`,
+		),
+		Want: wantLines(
+			`g f e d c b a f d b f c g e c`,
+		),
+	},
+
+	"ReverseStepRange": &TestCase{
+		Args: []string{`{<::2}`, `{<1:6:-2}`, `#{::2}`},
+		Input: wantLines(
+			`a b c d e f g`,
+		),
+		Want: wantLines(
+			`g e c a b d f abcdefg`,
+		),
+	},
+
+	"Complement": &TestCase{
+		Args:  []string{`{!3}`, `{!-2:}`, `{!1:2,4:}`, `{!0}`},
+		Input: "a b c d e\n",
+		Want:  "a b d e a b c c a b c d e\n",
+	},
+
+	"ComplementNonGreedy": &TestCase{
+		Args:  []string{`:{?!2}`, `:{!?2}`, `:{!2}`},
+		Input: "a::b:c\n",
+		Want:  "a:b:c a:b:c a:c\n",
+	},
+
+	"ComplementRegexp": &TestCase{
+		Args:  []string{`{!/^[0-9]+$/}`, `{/\d{2}/}`, `:{!/a{2}\}/}`},
+		Input: "a 1 b 22 c\n",
+		Want:  "a b c 22 a 1 b 22 c\n",
+	},
+
+	"ComplementRunes": &TestCase{
+		Args:  []string{`#{!1,-1}`},
+		Input: "[value]\n",
+		Want:  "value\n",
+	},
+
 	"ZeroRange": &TestCase{
 		Args: []string{`{0}`, `{0:0}`, `0`},
 		Input: wantLines(
@@ -282,6 +336,80 @@ var testCases = map[string]*TestCase{
 		Want:  "foo\n",
 	},
 
+	"RegexpFlags": &TestCase{
+		Args:  []string{`/addr:/i`, `/tmp/!`, `/^B/i!`, `{!/TMP/i}`},
+		Input: "ADDR:1 /tmp/x addr:2 b\n",
+		Want:  "ADDR:1 addr:2 ADDR:1 addr:2 b ADDR:1 /tmp/x addr:2 ADDR:1 addr:2 b\n",
+	},
+
+	"RegexpFlagsChained": &TestCase{
+		Args:  []string{`/MTU:/i:-1`},
+		Input: "wlan0 flags=4163 mtu:1500\n",
+		Want:  "1500\n",
+	},
+
+	"RegexpCapture": &TestCase{
+		Args:  []string{`/addr:(\S+)/$1`, `/(?P<key>\w+)=(?P<val>\w+)/$val,$key`, `/ADDR:([0-9.]+)/i$0`},
+		Input: "lo0 addr:127.0.0.1 mtu=1500\n",
+		Want:  "127.0.0.1 1500 mtu addr:127.0.0.1\n",
+	},
+
+	"RegexpCaptureChained": &TestCase{
+		Args:  []string{`/addr:(\S+)/$1.-1`, `/(a)|(b)/$1,$2='|'`},
+		Input: "en0 addr:10.1.0.24 b\n",
+		Want:  "24 a|||b\n",
+	},
+
+	"RegexpCaptureEscaped": &TestCase{
+		Args:  []string{`/\$/\$1`, `/\$(\d)/$1`},
+		Input: "price $5\n",
+		Want:  "5 5\n",
+	},
+
+	"BadRegexpCapture": &TestCase{
+		Args:   []string{`/a(b)/$2`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "/a(b)/$2": selector 1, character 7: invalid submatch reference: no submatch "2"`,
+			`    /a(b)/$2`,
+			`          ^`,
+		),
+	},
+
+	"GroupRegexpCapture": &TestCase{
+		Args:    []string{`{/a(b)/$1}`},
+		Status:  1,
+		WantErr: nonEmpty,
+	},
+
+	"Substitution": &TestCase{
+		Args:  []string{`s/["\[\]]//`, `s/(\d+)ms/$1/ 3`, `:s/^/-/`},
+		Input: "[a] \"b\" 12ms\n",
+		Want:  "a b 12ms 12 -[a] \"b\" 12ms\n",
+	},
+
+	"SubstitutionFlags": &TestCase{
+		Args:  []string{`s/A/x/i`, `,s/\//|/ 1`, `s/a/y/gi`},
+		Input: "aA,b/c/d\n",
+		Want:  "xx,b/c/d aA,b|c|d yy,b/c/d\n",
+	},
+
+	"SubstitutionKeepsFields": &TestCase{
+		Args:  []string{`:s/^b.*//:{?3}`, `s/\w+/x/ {1,3}`},
+		Input: "a:bc:d e\n",
+		Want:  "d e x:x:x\n",
+	},
+
+	"UnknownRegexpFlag": &TestCase{
+		Args:   []string{`/x/iq`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "/x/iq": selector 1, character 5: unknown regexp flag: 'q'`,
+			`    /x/iq`,
+			`        ^`,
+		),
+	},
+
 	// Tokenizing options {...} and {?...}
 	"Greedy": &TestCase{
 		Args:  []string{`:{3}`},
@@ -295,6 +423,173 @@ var testCases = map[string]*TestCase{
 		Want:  "bar\n",
 	},
 
+	// Quote-aware tokenizing {"...} and {'...}
+	"QuoteAware": &TestCase{
+		Args:  []string{`{"6}`, `{'6}`, `{"6} 2`, `{"!1:5}`},
+		Input: `1.2.3.4 - - [10/Oct/2026:13:55:36 -0700] "GET / HTTP/1.1" 200` + "\n",
+		Want:  `GET / HTTP/1.1 "GET / HTTP/1.1" / GET / HTTP/1.1 200` + "\n",
+	},
+
+	"QuoteAwareEscapes": &TestCase{
+		Args:  []string{`{"1}`, `{'1}`, `{"2:}`, `{'-1}`},
+		Input: `a\ "b c"d 'e "f' "g \"h\""` + "\n",
+		Want:  `a b cd a\ "b c"d e "f g "h" "g \"h\""` + "\n",
+	},
+
+	"QuoteAwareNonGreedy": &TestCase{
+		Args:  []string{`,{?"2}`, `,{?"3}`, `,{"3}`, `,{"?2:}`},
+		Input: `a,"b,c",,d` + "\n",
+		Want:  `b,c  d b,c,,d` + "\n",
+	},
+
+	"QuoteAwareEmptyField": &TestCase{
+		Args:  []string{`{"2:3}`, `{'2}`},
+		Input: `a "" b` + "\n",
+		Want:  ` b ""` + "\n",
+	},
+
+	"QuoteAwareRegexpDelimiter": &TestCase{
+		Args:   []string{`~/ /~{"1}`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "~/ /~{\"1}": selector 1, character 7: unexpected character: '"' cannot be used with a regexp delimiter`,
+			`    ~/ /~{"1}`,
+			`          ^`,
+		),
+	},
+
+	// Quoted delimiters
+	"QuotedDelimiterEscaped": &TestCase{
+		Args:  []string{`\'2\'1`, `'2'1`},
+		Input: "name='abc def' x\n",
+		Want:  "abc def name='abc def' x\n",
+	},
+
+	"QuotedDelimiter": &TestCase{
+		Args:  []string{`'::'2`, `' -> '{1,3}`},
+		Input: "a::b:c::::d -> e -> f -> -> g\n",
+		Want:  "b:c a::b:c::::d -> f\n",
+	},
+
+	"QuotedNonGreedy": &TestCase{
+		Args:  []string{`'::'{?3}`, `'::'{?-1}`},
+		Input: "a::b:c::::d\n",
+		Want:  " d\n",
+	},
+
+	"QuotedEscapes": &TestCase{
+		Args:  []string{`'\t\''2`, `'\\'1`},
+		Input: "a\t'b\\c\t'd\n",
+		Want:  "b\\c a\t'b\n",
+	},
+
+	"QuotedChained": &TestCase{
+		Args:  []string{`', '2'='-1`},
+		Input: "a=1, b=2, c=3\n",
+		Want:  "2\n",
+	},
+
+	"SingleQuoteDelimiter": &TestCase{
+		Args:  []string{`'2`},
+		Input: "a'b'c\n",
+		Want:  "b\n",
+	},
+
+	"EmptyQuotedDelimiter": &TestCase{
+		Args:   []string{`1''2`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "1''2": selector 2, character 2: empty delimiter`,
+			`    1''2`,
+			`     ^`,
+		),
+	},
+
+	// Regexp delimiters
+	"RegexpDelimiter": &TestCase{
+		Args:  []string{`~/[,;]\s*/~2`, `~/[,;]\s*/~{1,3}`},
+		Input: "a, b;c ;  d,\te\n",
+		Want:  "b a c \n",
+	},
+
+	"RegexpDelimiterNonGreedy": &TestCase{
+		Args:  []string{`~/[,;]\s*/~{?1:}='|'`},
+		Input: "a, ;c\n",
+		Want:  "a||c\n",
+	},
+
+	"RegexpDelimiterEscapedSlash": &TestCase{
+		Args:  []string{`~/\/+/~-1`},
+		Input: "a//b///c\n",
+		Want:  "c\n",
+	},
+
+	"RegexpDelimiterEscaped": &TestCase{
+		Args:  []string{`~/x/\~1`, `~/x/~1`},
+		Input: "x~y\n",
+		Want:  "x ~y\n",
+	},
+
+	"RegexpDelimiterChained": &TestCase{
+		Args:  []string{`~/\s*=\s*/~2 1`},
+		Input: "key =  value rest\n",
+		Want:  "value\n",
+	},
+
+	"BadRegexpDelimiter": &TestCase{
+		Args:   []string{`~/(/~2`},
+		Status: 1,
+		WantErr: wantLines(
+			"Error parsing extract 1: \"~/(/~2\": selector 1, character 3: invalid regexp: error parsing regexp: missing closing ): `(`",
+			`    ~/(/~2`,
+			`      ^`,
+		),
+	},
+
+	// Join overrides
+	"JoinOverride": &TestCase{
+		Args:  []string{`:{1,3}=','`, `:{1,3}='\t'\t2`, `'::'{1:}=''`},
+		Input: "a::b:c\n",
+		Want:  "a,c c ab:c\n",
+	},
+
+	"JoinOverrideAlone": &TestCase{
+		Args:    []string{`=','`},
+		Status:  1,
+		WantErr: nonEmpty,
+	},
+
+	// Rune and byte ranges
+	"RuneRange": &TestCase{
+		Args:  []string{`#{5:12}`, `#{<1:3,-1}`, `#{-3:}`},
+		Input: "añb:c123456789xyz\n",
+		Want:  "c1234567 bñaz xyz\n",
+	},
+
+	"ByteRange": &TestCase{
+		Args:  []string{`%{1:3}`, `%{4}`},
+		Input: "añbc\n",
+		Want:  "añ b\n",
+	},
+
+	"RuneRangeEscaped": &TestCase{
+		Args:  []string{`\#{1:2}`, `#{1:2}`, `\%{2}`, `%{2}`},
+		Input: "a#b%c\n",
+		Want:  "a#b%c a# c #\n",
+	},
+
+	"RuneRangeChained": &TestCase{
+		Args:  []string{`2#{1:3}`, `#{1:7}:2`, `1#{2,4}='-' 1`},
+		Input: "2024:10:16 13:55:36\n",
+		Want:  "13: 10 0-4\n",
+	},
+
+	"EscapedRangeMarker": &TestCase{
+		Args:  []string{`\#{2}`, `\%{1}`},
+		Input: "a#b%c\n",
+		Want:  "b%c a#b\n",
+	},
+
 	// Invalid ranges
 	"BadRelativeRange": &TestCase{
 		Args:   []string{`{-2:-3}`},
@@ -303,7 +598,9 @@ var testCases = map[string]*TestCase{
 			`a b c d e f g`,
 		),
 		WantErr: wantLines(
-			`Error parsing extract 1: "{-2:-3}": cannot parse "-2:-3": start > end is invalid: -2 > -3`,
+			`Error parsing extract 1: "{-2:-3}": selector 1, character 2: invalid field range: start > end is invalid: -2 > -3`,
+			`    {-2:-3}`,
+			`     ^`,
 		),
 	},
 
@@ -314,7 +611,713 @@ var testCases = map[string]*TestCase{
 			`a b c d e f g`,
 		),
 		WantErr: wantLines(
-			`Error parsing extract 1: "{1,3:1}": cannot parse "3:1": start > end is invalid: 3 > 1`,
+			`Error parsing extract 1: "{1,3:1}": selector 1, character 4: invalid field range: start > end is invalid: 3 > 1`,
+			`    {1,3:1}`,
+			`       ^`,
+		),
+	},
+
+	"ZeroStep": &TestCase{
+		Args:   []string{`{1:3:0}`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "{1:3:0}": selector 1, character 6: invalid field range: step cannot be 0`,
+			`    {1:3:0}`,
+			`         ^`,
+		),
+	},
+
+	// CSV and TSV input
+	"CSV": &TestCase{
+		Args:  []string{`--csv`, `2`, `{3,1}`, `,{1,3}`, `0`, `1,1`},
+		Input: "\"Smith, J\",\"a \"\"b\"\"\",3\nx,y,z\n",
+		Want:  "a \"b\" 3 Smith, J Smith, J,3 \"Smith, J\",\"a \"\"b\"\"\",3 Smith\ny z x x,z x,y,z x\n",
+	},
+
+	"CSVMultiLine": &TestCase{
+		Args:  []string{`2`, `--csv`, `-1`},
+		Input: "a,\"b\nc\",d\r\ne,f\n",
+		Want:  "b\nc d\nf f\n",
+	},
+
+	"CSVOptions": &TestCase{
+		Args:  []string{`--comma=;`, `--lazy-quotes`, `--comment`, `#`, `2`},
+		Input: "# a;b\na;b \"c\"\n",
+		Want:  "b \"c\"\n",
+	},
+
+	"CSVError": &TestCase{
+		Args:    []string{`--csv`, `1`},
+		Input:   "a,\"b\"c\nd\n",
+		Want:    "d\n",
+		WantErr: "CSV error: parse error on line 1, column 5: extraneous or missing \" in quoted-field\n",
+	},
+
+	"TSV": &TestCase{
+		Args:  []string{`--tsv`, `2`, `-1`, `2 1`},
+		Input: "a\tb c\t\td\n",
+		Want:  "b c d b\n",
+	},
+
+	"TSVQuotes": &TestCase{
+		Args:  []string{`--tsv`, `2`, `1`},
+		Input: "5\" x\t\"a\"\n",
+		Want:  "\"a\" 5\" x\n",
+	},
+
+	"TSVEscapes": &TestCase{
+		Args:  []string{`--tsv`, `--output`, `tsv`, `2`, `1`, `0`},
+		Input: "a\\tb\tc\\nd\\\\n\n",
+		Want:  "c\\nd\\\\n\ta\\tb\ta\\\\tb\\tc\\\\nd\\\\\\\\n\n",
+	},
+
+	"TSVLazyQuotes": &TestCase{
+		Args:    []string{`--tsv`, `--lazy-quotes`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: --lazy-quotes cannot be used with --tsv\n",
+	},
+
+	"DashExtracts": &TestCase{
+		Args:  []string{`--1`, `-csv`, `-2`},
+		Input: "a-b-c,d,e\n",
+		Want:  "e d\n",
+	},
+
+	"BadOptions": &TestCase{
+		Args:    []string{`--csv`, `--tsv`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: --csv and --tsv cannot be used together\n",
+	},
+
+	"MissingOptionValue": &TestCase{
+		Args:    []string{`1`, `--comma`},
+		Status:  2,
+		WantErr: "Error parsing options: flag needs an argument: -comma\n",
+	},
+
+	// Header column names
+	"Header": &TestCase{
+		Args:  []string{`-H`, `{PID,%CPU}`, `{@USER:@%CPU}`, `{!PID:-2} 1`},
+		Input: "USER PID %CPU COMMAND\nroot 1 0.5 init\nme 20 1.0 sh\n",
+		Want:  "1 0.5 root 1 0.5 root\n20 1.0 me 20 1.0 me\n",
+	},
+
+	"HeaderCSV": &TestCase{
+		Args:  []string{`--csv`, `--header`, `{b c}`, `{a}`},
+		Input: "a,b c,a b\n1,\"2,3\",4\n",
+		Want:  "2,3 1\n",
+	},
+
+	"HeaderDelimiters": &TestCase{
+		Args:  []string{`-H`, `:{b}`, `{b}`},
+		Input: "b:c b\n1:2 3\n",
+		Want:  "1 3\n",
+	},
+
+	"HeaderReversedRange": &TestCase{
+		Args:    []string{`-H`, `{COMMAND:USER}`},
+		Status:  1,
+		Input:   "USER PID COMMAND\nroot 1 init\n",
+		WantErr: "Error in extract 1: \"{COMMAND:USER}\": columns COMMAND:USER: start > end is invalid: 3 > 1\n",
+	},
+
+	"HeaderMissing": &TestCase{
+		Args:    []string{`-H`, `1`, `{x}`},
+		Status:  1,
+		Input:   "a b\n1 2\n",
+		WantErr: "Error in extract 2: \"{x}\": no column named \"x\"\n",
+	},
+
+	"HeaderAmbiguous": &TestCase{
+		Args:    []string{`-H`, `{a}`},
+		Status:  1,
+		Input:   "a b a\n1 2 3\n",
+		WantErr: "Error in extract 1: \"{a}\": column name \"a\" is ambiguous: columns 1 and 3\n",
+	},
+
+	"HeaderRequired": &TestCase{
+		Args:    []string{`{a}`},
+		Status:  1,
+		Input:   "a b\n",
+		WantErr: "Error in extract 1: \"{a}\": column \"a\": no header (column names require -H)\n",
+	},
+
+	"HeaderNotFirstSelector": &TestCase{
+		Args:    []string{`-H`, `1:{a}`},
+		Status:  1,
+		Input:   "a b\n",
+		WantErr: "Error in extract 1: \"1:{a}\": selector 2: column names can only be used in the first selector\n",
+	},
+
+	// Fixed-width columns
+	"Fixed": &TestCase{
+		Args: []string{`--fixed`, `2`, `3 1`, `-1`},
+		Input: "USER   PID COMMAND\n" +
+			"root     1 /sbin/init splash\n" +
+			"me   12345 sh\n",
+		Want: "PID COMMAND COMMAND\n1 /sbin/init /sbin/init splash\n12345 sh sh\n",
+	},
+
+	"FixedHeader": &TestCase{
+		Args: []string{`-H`, `--fixed`, `{Mounted on}`, `{Use%,Filesystem}`, `{?1:3}`},
+		Input: "Filesystem Use% Mounted on\n" +
+			"/dev/sda1   40% /\n" +
+			"tmpfs        0% /dev/shm\n" +
+			"x\n",
+		Want: "/ 40% /dev/sda1 /dev/sda1 40% /\n/dev/shm 0% tmpfs tmpfs 0% /dev/shm\n  x x  \n",
+	},
+
+	// JSON selectors
+	"JSON": &TestCase{
+		Args: []string{`@.user.id`, `@{.req.path,.user.name}`, `@.tags[-1]`, `@.tags[*]='+'`, `@.o`, `@.user.name 2`},
+		Input: `{"user":{"id":42,"name":"Ann Lee"},"req":{"path":"/a"},"tags":["x","y"],"o":{"b":null,"a":[1.50]}}` + "\n" +
+			`{"user":{"id":"7"},"tags":[]}` + "\n",
+		Want: `42 /a Ann Lee y x+y {"a":[1.50],"b":null} Lee` + "\n" +
+			`7     ` + "\n",
+	},
+
+	"JSONKeyDigits": &TestCase{
+		Args:   []string{`@.ipv4`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "@.ipv4": selector 2, character 5: invalid JSON path: "@.ipv4" is ambiguous; write @{.ipv4} for the key`,
+			`    @.ipv4`,
+			`        ^`,
+		),
+	},
+
+	"JSONChained": &TestCase{
+		Args:  []string{`|2@.msg`, `|3@["a b"][0]:2`},
+		Input: `x|{"msg":true}|{"a b":["1:2"]}` + "\n",
+		Want:  "true 2\n",
+	},
+
+	"JSONGroupDelimiter": &TestCase{
+		Args:  []string{`@{2}`, `@{?1,3}`},
+		Input: "a@b@@c\n",
+		Want:  "b a@\n",
+	},
+
+	"BadJSONPath": &TestCase{
+		Args:   []string{`@.a[x]`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "@.a[x]": selector 1, character 5: invalid JSON path: invalid index "x"`,
+			`    @.a[x]`,
+			`        ^`,
+		),
+	},
+
+	// Key/value selectors
+	"KeyValue": &TestCase{
+		Args:  []string{`={level,dur}`, `={msg}`, `={flag,a}`, `={msg} 2`, `={1}`},
+		Input: `level=info msg="started \"x\" ok" dur=12ms flag a=1=2 level=warn` + "\n",
+		Want:  `info warn 12ms started "x" ok  1=2 "x" level` + "\n",
+	},
+
+	"KeyValueSeparators": &TestCase{
+		Args:  []string{`;=:{b,a}`, `;=:{c}`},
+		Input: `a:1;b:2 3;c:"x;y"` + "\n",
+		Want:  "2 3;1 x;y\n",
+	},
+
+	"KeyValueChained": &TestCase{
+		Args:  []string{`'; '={a}`, `|2 =:{k}`},
+		Input: "a=4; b=5|x k:v w:z\n",
+		Want:  "4 v\n",
+	},
+
+	"KeyValueEscapedGroup": &TestCase{
+		Args:  []string{`-H`, `\={b}`},
+		Input: "a=b\n1=2\n",
+		Want:  "2\n",
+	},
+
+	"KeyValueQuotedDelimiter": &TestCase{
+		Args:  []string{`'='{2}`},
+		Input: "a=b\n",
+		Want:  "b\n",
+	},
+
+	"KeyValueQuotedDelimiterRange": &TestCase{
+		Args:  []string{`'=='{1,2}`},
+		Input: "a==b==c\n",
+		Want:  "a==b\n",
+	},
+
+	"BadKeyValue": &TestCase{
+		Args:   []string{`={a,}`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "={a,}": selector 1, character 5: invalid key`,
+			`    ={a,}`,
+			`        ^`,
+		),
+	},
+
+	// Transforms
+	"Transform": &TestCase{
+		Args:  []string{`1|lower`, `2|trim([])|upper`, `:2|length`, `|upper`},
+		Input: "WWW.Example.COM [ok] a:bcde\n",
+		Want:  "www.example.com OK 4 WWW.EXAMPLE.COM [OK] A:BCDE\n",
+	},
+
+	"TransformPad": &TestCase{
+		Args:  []string{`1|pad(4,0)`, `2|pad(-3)|pad(5,'|')`, `1|pad(3,'\'')`},
+		Input: "7 ab\n12345 c\n",
+		Want:  "0007 ||ab  ''7\n12345 ||c   12345\n",
+	},
+
+	"TransformJSON": &TestCase{
+		Args:  []string{`@.a|upper`, `@.a 2|lower`, `@["b|c"]|length`},
+		Input: `{"a":"x Y","b|c":"abc"}` + "\n",
+		Want:  "X Y y 3\n",
+	},
+
+	"TransformRegexpAt": &TestCase{
+		Args:  []string{`/a@./|upper`},
+		Input: "a@.b c\n",
+		Want:  "A@.B\n",
+	},
+
+	"TransformChained": &TestCase{
+		Args:  []string{`1|trim('(,)')|lower:2`, `{1,3}|upper /^B/`, `--csv`},
+		Input: "\"(a:B),\",x,b\n",
+		Want:  "b B\n",
+	},
+
+	"TransformTime": &TestCase{
+		Args: []string{`"1[2]1|time(apache,rfc3339)`, `1|time(unix,'Jan 2, 2006 15:04',UTC)`},
+		Input: `1791665736 - - [10/Oct/2026:13:55:36 -0700] "GET / HTTP/1.1" 200` + "\n" +
+			`x - - [10/Oct/2026:13:55:36 -0700] "GET / HTTP/1.1" 200` + "\n",
+		Want:    "2026-10-10T13:55:36-07:00 Oct 10, 2026 20:55\n",
+		WantErr: "time: invalid Unix time \"x\"\n",
+	},
+
+	"TransformDecode": &TestCase{
+		Args:  []string{`2|decode(url)`, `3|decode(base64)|upper`, `2|decode(url)|encode(html)`},
+		Input: "GET /a%20b%3Cc%3E aGk=\nGET /%zz aGk=\nGET /c !!\n",
+		Want:  "/a b<c> HI /a b&lt;c&gt;\n",
+		WantErr: wantLines(
+			`decode: invalid url "/%zz"`,
+			`decode: invalid base64 "!!"`,
+		),
+	},
+
+	"TransformErrorPolicy": &TestCase{
+		Args:  []string{`1|decode(hex,onerror=keep)`, `1|decode(hex,onerror=empty)|pad(2,-)`, `2|decode(json,'onerror=fail')`},
+		Input: "6869 \"a\\tb\"\nxyz c\\q\n",
+		Want:  "hi hi a\tb\n",
+		WantErr: wantLines(
+			`decode: invalid json "c\\q"`,
+		),
+	},
+
+	"BadTransformPolicy": &TestCase{
+		Args:   []string{`1|encode(url,onerror=skip)`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "1|encode(url,onerror=skip)": selector 2, character 3: invalid transform: encode: unknown error policy "skip"; must be fail, keep, or empty`,
+			`    1|encode(url,onerror=skip)`,
+			`      ^`,
+		),
+	},
+
+	"BadTransform": &TestCase{
+		Args:   []string{`1|lower|Trim`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "1|lower|Trim": selector 3, character 9: invalid transform: no transform named "Trim"; known transforms are decode, encode, length, lower, pad, time, trim, upper`,
+			`    1|lower|Trim`,
+			`            ^`,
+		),
+	},
+
+	"BadTransformArgs": &TestCase{
+		Args:   []string{`1|pad(4,ab)`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "1|pad(4,ab)": selector 2, character 3: invalid transform: pad: padding must be a single character: "ab"`,
+			`    1|pad(4,ab)`,
+			`      ^`,
+		),
+	},
+
+	// Output formats
+	"OutputNUL": &TestCase{
+		Args:  []string{`--output=nul`, `-1`},
+		Input: "a b c\nd\n",
+		Want:  "c\x00d\x00",
+	},
+
+	"OutputNULColumns": &TestCase{
+		Args:    []string{`--output=nul`, `--with-filename`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: nul output can only be used with one column, not 2\n",
+	},
+
+	"OutputCSV": &TestCase{
+		Args:  []string{`--output`, `csv`, `1`, `{2:}`},
+		Input: "a b,c\n\"x\" y\n",
+		Want:  "a,\"b,c\"\n\"\"\"x\"\"\",y\n",
+	},
+
+	"OutputCSVNamed": &TestCase{
+		Args:  []string{`--output=csv`, `first=1`, `{2:}`},
+		Input: "a b c\n",
+		Want:  "first,{2:}\na,b c\n",
+	},
+
+	"OutputTSV": &TestCase{
+		Args:  []string{`--output=tsv`, `--csv`, `key=1`, `value=2`},
+		Input: "a,\"b\tc\\\"\nd,\"e\nf\"\n",
+		Want:  "key\tvalue\na\tb\\tc\\\\\nd\te\\nf\n",
+	},
+
+	"OutputJSON": &TestCase{
+		Args:  []string{`--output=json`, `1`, `{2:}`},
+		Input: "a <b> \"c\"\nd\n",
+		Want:  "[\n[\"a\",\"<b> \\\"c\\\"\"],\n[\"d\",\"\"]\n]\n",
+	},
+
+	"OutputJSONEmpty": &TestCase{
+		Args:  []string{`--output=json`, `1`},
+		Input: "",
+		Want:  "[]\n",
+	},
+
+	"OutputKeepsEmpty": &TestCase{
+		Args:  []string{`--output`, `jsonl`, `x=1`},
+		Input: "a\n\nb\n",
+		Want:  "{\"x\":\"a\"}\n{\"x\":\"\"}\n{\"x\":\"b\"}\n",
+	},
+
+	"OutputJSONLines": &TestCase{
+		Args:  []string{`--output=jsonl`, `user_1=1`, `={dur}`},
+		Input: "ann dur=1s\nbob\n",
+		Want:  "{\"user_1\":\"ann\",\"={dur}\":\"1s\"}\n{\"user_1\":\"bob\",\"={dur}\":\"\"}\n",
+	},
+
+	"OutputSkipsErrors": &TestCase{
+		Args:    []string{`1`, `@.a`},
+		Input:   "{}\nx\n",
+		Want:    "{} \n",
+		WantErr: "invalid JSON: invalid character 'x' looking for beginning of value\n",
+	},
+
+	"OutputSeparators": &TestCase{
+		Args:  []string{`-o`, `\t`, `--ors=;\n`, `1`, `3`, `:{1,3}=','`},
+		Input: "a:b:c d\ne f g\n",
+		Want:  "a:b:c\t\ta,c d;\ne\tg\te f g;\n",
+	},
+
+	"OutputSeparatorsEmpty": &TestCase{
+		Args:  []string{`--ofs=`, `--ors`, `\z`, `1`, `2`},
+		Input: "a b\nc d\n",
+		Want:  "ab\x00cd\x00",
+	},
+
+	"BadOutputSeparators": &TestCase{
+		Args:    []string{`--output=csv`, `--ofs=;`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: --ofs and --ors can only be used with plain output\n",
+	},
+
+	"RecordNUL": &TestCase{
+		Args:  []string{`-z`, `2`, `=2`},
+		Input: "PATH=/bin\x00A B=x\ny\x00C D\x00",
+		Want:  " /bin\nB=x\ny x\ny\nD \n",
+	},
+
+	"RecordSeparator": &TestCase{
+		Args:  []string{`--rs`, `;;\n`, `,2`},
+		Input: "a,b;;\nc,d\ne;;\nf,g",
+		Want:  "b\nd\ne\ng\n",
+	},
+
+	"RecordSeparatorFixed": &TestCase{
+		Args:  []string{`--rs=;`, `--fixed`, `-H`, `{NAME}`},
+		Input: "ID NAME;1  a;2  bc;",
+		Want:  "a\nbc\n",
+	},
+
+	"Paragraph": &TestCase{
+		Args: []string{`-p`, `1:2`, `/^age/ 2`},
+		Input: "\n\ndn: a\r\nage: 30\r\n\r\n\n" +
+			"dn: b\nname: x y\nage: 4\n",
+		Want: " a 30\n b 4\n",
+	},
+
+	"ParagraphDelimiter": &TestCase{
+		Args:  []string{`--paragraph`, `2`, `2 1`, `#{1}`},
+		Input: "a b\nc d\n\ne f\n",
+		Want:  "c d c a\n  e\n",
+	},
+
+	"BadRecordSeparators": &TestCase{
+		Args:    []string{`-z`, `--rs=;`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: only one of -z, --rs, and --paragraph can be used\n",
+	},
+
+	"BadRecordSeparatorCSV": &TestCase{
+		Args:    []string{`--csv`, `-p`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: -z, --rs, and --paragraph cannot be used with CSV input\n",
+	},
+
+	"EmptyRecordSeparator": &TestCase{
+		Args:    []string{`--rs=`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: --rs cannot be empty\n",
+	},
+
+	"Files": &TestCase{
+		Args:  []string{`-f`, `testdata/logs/access.log`, `2`, `-f=testdata/logs/error.log`, `3`},
+		Input: "ignored\n",
+		Want:  "/a 200\n/b 404\ndisk full\n",
+	},
+
+	// Arguments after -- are files, even if they name an option.
+	"FilesDashDash": &TestCase{
+		Args:    []string{`1`, `--`, `testdata/logs/error.log`, `-`, `-f`},
+		Input:   "stdin\n",
+		Want:    "error:\nstdin\n",
+		Status:  1,
+		WantErr: "IO error: stat -f: no such file or directory\n",
+	},
+
+	"FilesDirectory": &TestCase{
+		Args: []string{`--with-filename`, `--with-line-number`, `2`, `--`, `testdata/logs`},
+		Want: "testdata/logs/access.log 1 /a\n" +
+			"testdata/logs/access.log 2 /b\n" +
+			"testdata/logs/error.log 1 disk\n" +
+			"testdata/logs/old/access.log 1 /c\n",
+	},
+
+	"FilesMissing": &TestCase{
+		Args:    []string{`-f`, `testdata/missing.log`, `-f`, `testdata/logs/error.log`, `1`},
+		Status:  1,
+		Want:    "error:\n",
+		WantErr: "IO error: stat testdata/missing.log: no such file or directory\n",
+	},
+
+	"FilesHeader": &TestCase{
+		Args: []string{`--csv`, `-H`, `--with-filename`, `{name}`, `{size}`, `--`, `testdata/sizes.csv`, `testdata/sizes2.csv`},
+		Want: "testdata/sizes.csv x 1\ntestdata/sizes.csv y 2\ntestdata/sizes2.csv z 3\n",
+	},
+
+	"FilesHeaderError": &TestCase{
+		Args:    []string{`--csv`, `-H`, `{name}`, `--`, `testdata/logs/error.log`, `testdata/sizes.csv`},
+		Status:  1,
+		Want:    "x\ny\n",
+		WantErr: "testdata/logs/error.log: Error in extract 1: \"{name}\": no column named \"name\"\n",
+	},
+
+	"LineNumbersStdin": &TestCase{
+		Args:  []string{`--with-line-number`, `--with-filename`, `--output=jsonl`, `a=1`},
+		Input: "x\n\ny\n",
+		Want: `{"filename":"-","line":"1","a":"x"}` + "\n" +
+			`{"filename":"-","line":"2","a":""}` + "\n" +
+			`{"filename":"-","line":"3","a":"y"}` + "\n",
+	},
+
+	"LineNumbersDuplicateName": &TestCase{
+		Args:    []string{`--with-line-number`, `line=1`},
+		Status:  1,
+		WantErr: "Error parsing extract 1: \"line=1\": duplicate name \"line\"\n",
+	},
+
+	"Where": &TestCase{
+		Args:  []string{`--where`, `3==500`, `2`},
+		Input: "GET /a 200\nGET /b 500\nPOST /c 5000\nPUT /d 500\n",
+		Want:  "/b\n/d\n",
+	},
+
+	"WhereRegexp": &TestCase{
+		Args:  []string{`2`, `--where=3=~^5`, `--where`, `1=~^(GET|PUT)$`},
+		Input: "GET /a 200\nGET /b 500\nPOST /c 5000\nPUT /d 503\n",
+		Want:  "/b\n/d\n",
+	},
+
+	"WhereInvert": &TestCase{
+		Args:  []string{`--invert`, `--where`, `:1=~^#`, `1`},
+		Input: "a: 1\n#b: 2\n\nc\n",
+		Want:  "a:\nc\n",
+	},
+
+	// Conditions are split at the first == or =~, so values may contain
+	// either.
+	"WhereSplit": &TestCase{
+		Args:  []string{`--where`, `1==a=~b`, `--where`, `:{1,2}='='=~a=b$`, `2`},
+		Input: "a=~b a:b\na=~b c:d\nx a:b\n",
+		Want:  "a:b\n",
+	},
+
+	"WhereHeader": &TestCase{
+		Args:  []string{`--csv`, `-H`, `--where`, `{status}==500`, `{path}`},
+		Input: "path,status\n/a,200\n/b,500\n",
+		Want:  "/b\n",
+	},
+
+	"WhereLineNumbers": &TestCase{
+		Args:  []string{`--with-line-number`, `--where`, `1==x`, `2`},
+		Input: "x a\ny b\nx c\n",
+		Want:  "1 a\n3 c\n",
+	},
+
+	"BadWhere": &TestCase{
+		Args:    []string{`--where`, `3=500`, `1`},
+		Status:  1,
+		WantErr: "Error parsing --where \"3=500\": missing == or =~\n",
+	},
+
+	"BadWhereRegexp": &TestCase{
+		Args:    []string{`--where`, `3=~(`, `1`},
+		Status:  1,
+		WantErr: "Error parsing --where \"3=~(\": error parsing regexp: missing closing ): `(`\n",
+	},
+
+	"BadWhereExtract": &TestCase{
+		Args:   []string{`--where`, `3x==1`, `1`},
+		Status: 1,
+		WantErr: "Error parsing --where \"3x==1\": selector 1, character 2: unexpected character: 'x'\n" +
+			"    3x\n" +
+			"     ^\n",
+	},
+
+	"BadWhereHeader": &TestCase{
+		Args:    []string{`--where`, `{a}==1`, `1`},
+		Status:  1,
+		WantErr: "Error in --where \"{a}==1\": column \"a\": no header (column names require -H)\n",
+	},
+
+	"BadInvert": &TestCase{
+		Args:    []string{`--invert`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: --invert requires --where or --if\n",
+	},
+
+	"If": &TestCase{
+		Args: []string{`--if`, `$3 >= 500 && $1 ~ /^10\./`, `1`, `3`},
+		Input: "10.0.0.1 GET 500\n10.0.0.2 GET 200\n" +
+			"192.168.0.1 GET 503\n10.0.0.3 GET 404.5e0\n10.0.0.4 GET 5e2\n",
+		Want: "10.0.0.1 500\n10.0.0.4 5e2\n",
+	},
+
+	"IfArithmetic": &TestCase{
+		Args:  []string{`--if`, `-$1 * 2 + 10 / 4 % 2 < -1 && ($2 - $1) % 2 == 1`, `0`},
+		Input: "0 1\n1 2\n2 3\n2 4\n3 6\n",
+		Want:  "1 2\n2 3\n3 6\n",
+	},
+
+	"IfStrings": &TestCase{
+		Args:  []string{`--if`, `${:1} < "m" || $2 !~ "^[a-z]+$" && !($2 == "x" || $2 >= "y")`, `1`},
+		Input: "a:1 b\nn:2 B\nz:3 x\nz:4 Y2\nz:5 ~z\n",
+		Want:  "a:1\nn:2\nz:4\n",
+	},
+
+	// Values that aren't numbers are NaN, which doesn't compare equal to
+	// anything.
+	"IfNaN": &TestCase{
+		Args:  []string{`--if`, `$2 >= 0 || $2 < 0 || $2 == "-"`, `1`},
+		Input: "a 1\nb -\nc x\nd 2\n",
+		Want:  "a\nb\nd\n",
+	},
+
+	// Values compared with each other are numbers if both are numbers.
+	"IfFields": &TestCase{
+		Args:  []string{`--if`, `$3 > $2`, `1`},
+		Input: "a 500 9\nb 9 500\nc 1e3 999\nd abc b\ne 10 b\n",
+		Want:  "b\nd\ne\n",
+	},
+
+	"IfHeader": &TestCase{
+		Args:  []string{`--csv`, `-H`, `--if`, `(${{size}} > 1024) == true`, `--if`, `${{name}} != ""`, `{name}`},
+		Input: "name,size\na,10\nb,2048\n,4096\n",
+		Want:  "b\n",
+	},
+
+	"IfInvert": &TestCase{
+		Args:  []string{`--invert`, `--where`, `1==a`, `--if`, `$2 > 1`, `0`},
+		Input: "a 1\na 2\nb 2\n",
+		Want:  "a 1\nb 2\n",
+	},
+
+	"BadIf": &TestCase{
+		Args:   []string{`--if`, `$1 > 1 &&`, `1`},
+		Status: 1,
+		WantErr: "Error parsing --if \"$1 > 1 &&\": character 10: unexpected end of expression\n" +
+			"    $1 > 1 &&\n" +
+			"             ^\n",
+	},
+
+	"BadIfType": &TestCase{
+		Args:   []string{`--if`, `$1 == "a" && $2 - "b" > 0`, `1`},
+		Status: 1,
+		WantErr: "Error parsing --if \"$1 == \\\"a\\\" && $2 - \\\"b\\\" > 0\": character 19: expected a number, found a string\n" +
+			"    $1 == \"a\" && $2 - \"b\" > 0\n" +
+			"                      ^\n",
+	},
+
+	"BadIfExtract": &TestCase{
+		Args:   []string{`--if`, `${3x} == 1`, `1`},
+		Status: 1,
+		WantErr: "Error parsing --if \"${3x} == 1\": extract \"3x\": selector 1, character 2: unexpected character: 'x'\n" +
+			"    3x\n" +
+			"     ^\n",
+	},
+
+	"BadOutput": &TestCase{
+		Args:    []string{`--output=xml`, `1`},
+		Status:  2,
+		WantErr: "Error parsing options: unknown output format \"xml\"\n",
+	},
+
+	"DuplicateName": &TestCase{
+		Args:    []string{`a=1`, `a=2`},
+		Status:  1,
+		WantErr: "Error parsing extract 2: \"a=2\": duplicate name \"a\"\n",
+	},
+
+	// Parse errors
+	"BadNumber": &TestCase{
+		Args:   []string{`:{1,2:3x}`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: ":{1,2:3x}": selector 1, character 7: invalid field number: "3x": invalid syntax`,
+			`    :{1,2:3x}`,
+			`          ^`,
+		),
+	},
+
+	"BadRegexp": &TestCase{
+		Args:   []string{`"2 /addr:(/:-1`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "\"2 /addr:(/:-1": selector 2, character 5: invalid regexp: error parsing regexp: missing closing ): `+"`addr:(`",
+			`    "2 /addr:(/:-1`,
+			`        ^`,
+		),
+	},
+
+	"UnexpectedRune": &TestCase{
+		Args:   []string{`"2 2/addr:/:-1`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "\"2 2/addr:/:-1": selector 2, character 3: unexpected character: ' '`,
+			`    "2 2/addr:/:-1`,
+			`      ^`,
+		),
+	},
+
+	"UnmatchedBrace": &TestCase{
+		Args:   []string{`1 2}`},
+		Status: 1,
+		WantErr: wantLines(
+			`Error parsing extract 1: "1 2}": selector 3, character 4: unmatched '}'`,
+			`    1 2}`,
+			`       ^`,
 		),
 	},
 }
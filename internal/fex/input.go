@@ -0,0 +1,268 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"go.spiff.io/go-fex/fex"
+)
+
+// record is a single record of input. If fields is not nil, the record was
+// split into fields when it was read, such as a CSV record, and line is the
+// text selected by the field index 0.
+type record struct {
+	line   string
+	fields []string
+}
+
+// recordReader reads records from input. At the end of input, it returns
+// io.EOF and no record.
+type recordReader interface {
+	ReadRecord() (record, error)
+}
+
+// lineReader reads newline-terminated records, trimming the trailing newline
+// and carriage return, if any.
+type lineReader struct {
+	rd  *bufio.Reader
+	err error // Error to return after the last line
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{rd: bufio.NewReader(r)}
+}
+
+func (lr *lineReader) ReadRecord() (record, error) {
+	if lr.err != nil {
+		return record{}, lr.err
+	}
+	line, err := lr.rd.ReadString('\n')
+	if line == "" && err != nil {
+		return record{}, err
+	}
+	lr.err = err
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return record{line: line}, nil
+}
+
+// sepReader reads records terminated by a separator, sep, which may be longer
+// than one byte. The separator is removed from each record, and the last
+// record need not be terminated.
+type sepReader struct {
+	rd  *bufio.Reader
+	sep string
+	err error // Error to return after the last record
+}
+
+func newSepReader(r io.Reader, sep string) *sepReader {
+	return &sepReader{rd: bufio.NewReader(r), sep: sep}
+}
+
+func (sr *sepReader) ReadRecord() (record, error) {
+	if sr.err != nil {
+		return record{}, sr.err
+	}
+
+	var (
+		b    strings.Builder
+		last = sr.sep[len(sr.sep)-1]
+	)
+	for !strings.HasSuffix(b.String(), sr.sep) {
+		chunk, err := sr.rd.ReadString(last)
+		b.WriteString(chunk)
+		if err != nil {
+			sr.err = err
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return record{}, sr.err
+	}
+	return record{line: strings.TrimSuffix(b.String(), sr.sep)}, nil
+}
+
+// paragraphReader reads records separated by one or more blank lines. Each
+// record's line is the lines of the paragraph joined by newlines.
+type paragraphReader struct {
+	rd  *lineReader
+	err error // Error to return after the last record
+}
+
+func newParagraphReader(r io.Reader) *paragraphReader {
+	return &paragraphReader{rd: newLineReader(r)}
+}
+
+func (pr *paragraphReader) ReadRecord() (record, error) {
+	if pr.err != nil {
+		return record{}, pr.err
+	}
+
+	var lines []string
+	for {
+		rec, err := pr.rd.ReadRecord()
+		if err != nil {
+			pr.err = err
+			if len(lines) == 0 {
+				return record{}, err
+			}
+			break
+		}
+		if rec.line == "" {
+			if len(lines) == 0 {
+				continue
+			}
+			break
+		}
+		lines = append(lines, rec.line)
+	}
+	return record{line: strings.Join(lines, "\n")}, nil
+}
+
+// csvReader reads CSV records, as described by RFC 4180, using encoding/csv.
+// Each record's fields are its columns, and its line is the record re-encoded
+// as CSV.
+type csvReader struct {
+	rd    *csv.Reader
+	comma rune
+}
+
+func newCSVReader(r io.Reader, comma rune, lazyQuotes bool, comment rune) *csvReader {
+	rd := csv.NewReader(r)
+	rd.Comma = comma
+	rd.Comment = comment
+	rd.LazyQuotes = lazyQuotes
+	rd.FieldsPerRecord = -1
+	return &csvReader{rd: rd, comma: comma}
+}
+
+func (cr *csvReader) ReadRecord() (record, error) {
+	fields, err := cr.rd.Read()
+	if err != nil {
+		return record{}, err
+	}
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Comma = cr.comma
+	_ = w.Write(fields)
+	w.Flush()
+	return record{line: strings.TrimSuffix(b.String(), "\n"), fields: fields}, nil
+}
+
+// tsvUnescaper unescapes the values of tsvReader, which are escaped as they are
+// by tsvWriter.
+var tsvUnescaper = strings.NewReplacer(
+	`\\`, "\\",
+	`\t`, "\t",
+	`\n`, "\n",
+	`\r`, "\r",
+)
+
+// tsvReader reads lines of tab-separated values. Unlike CSV, fields are split on
+// every tab and cannot be quoted. Instead, the escapes \\, \t, \n, and \r in
+// fields are replaced by a backslash, tab, newline, and carriage return. Each
+// record's line is the line as read.
+type tsvReader struct {
+	rd      *lineReader
+	comment string // Prefix of lines to skip, if not empty
+}
+
+func newTSVReader(r io.Reader, comment string) *tsvReader {
+	return &tsvReader{rd: newLineReader(r), comment: comment}
+}
+
+func (tr *tsvReader) ReadRecord() (record, error) {
+	for {
+		rec, err := tr.rd.ReadRecord()
+		if err != nil {
+			return record{}, err
+		} else if tr.comment != "" && strings.HasPrefix(rec.line, tr.comment) {
+			continue
+		}
+		rec.fields = strings.Split(rec.line, "\t")
+		for i, field := range rec.fields {
+			rec.fields[i] = tsvUnescaper.Replace(field)
+		}
+		return rec, nil
+	}
+}
+
+// fixedSampleSize is the number of lines after the header read by fixedReader
+// to infer columns.
+const fixedSampleSize = 100
+
+// fixedReader reads lines of fixed-width text, such as the output of ps, and
+// splits them into columns inferred from the first line, a header, and the
+// lines following it. Each record's line is the line as read.
+type fixedReader struct {
+	rd     recordReader
+	cols   fex.Columns
+	buf    []record // Lines read to infer columns
+	err    error    // Error to return after buf
+	primed bool
+}
+
+func newFixedReader(rd recordReader) *fixedReader {
+	return &fixedReader{rd: rd}
+}
+
+func (fr *fixedReader) ReadRecord() (record, error) {
+	if !fr.primed {
+		fr.prime()
+	}
+
+	var rec record
+	switch {
+	case len(fr.buf) > 0:
+		rec, fr.buf = fr.buf[0], fr.buf[1:]
+	case fr.err != nil:
+		return record{}, fr.err
+	default:
+		var err error
+		if rec, err = fr.rd.ReadRecord(); err != nil {
+			return record{}, err
+		}
+	}
+	rec.fields = fr.cols.Split("", rec.line)
+	return rec, nil
+}
+
+// prime reads the header and sample lines and infers columns from them.
+func (fr *fixedReader) prime() {
+	fr.primed = true
+	for len(fr.buf) <= fixedSampleSize {
+		rec, err := fr.rd.ReadRecord()
+		if err != nil {
+			fr.err = err
+			break
+		}
+		fr.buf = append(fr.buf, rec)
+	}
+	if len(fr.buf) == 0 {
+		return
+	}
+
+	sample := make([]string, len(fr.buf)-1)
+	for i, rec := range fr.buf[1:] {
+		sample[i] = rec.line
+	}
+	fr.cols = fex.InferColumns(fr.buf[0].line, sample)
+}
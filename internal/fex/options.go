@@ -0,0 +1,249 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"go.spiff.io/go-fex/fex"
+)
+
+// options holds the command-line options of fex.
+type options struct {
+	header     bool
+	csv        bool
+	tsv        bool
+	comma      string
+	lazyQuotes bool
+	comment    string
+	fixed      bool
+	output     string
+	ofs        string
+	ors        string
+	zero       bool
+	rs         string
+	paragraph  bool
+	files      stringList
+	filename   bool
+	lineNumber bool
+	where      stringList
+	cond       stringList
+	invert     bool
+
+	set map[string]bool // Names of options given
+}
+
+// parseArgs parses the options in argv and returns the remaining arguments,
+// which are extracts. Options may appear anywhere in argv. Since many extracts
+// begin with a dash, such as --1, only arguments naming a known option are
+// treated as options. Arguments following "--" are files to read, as with -f.
+func (o *options) parseArgs(argv []string) (extracts []string, err error) {
+	fs := flag.NewFlagSet("fex", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&o.header, "H", false, "")
+	fs.BoolVar(&o.header, "header", false, "")
+	fs.BoolVar(&o.csv, "csv", false, "")
+	fs.BoolVar(&o.tsv, "tsv", false, "")
+	fs.StringVar(&o.comma, "comma", "", "")
+	fs.BoolVar(&o.lazyQuotes, "lazy-quotes", false, "")
+	fs.StringVar(&o.comment, "comment", "", "")
+	fs.BoolVar(&o.fixed, "fixed", false, "")
+	fs.StringVar(&o.output, "output", outputPlain, "")
+	fs.StringVar(&o.ofs, "o", " ", "")
+	fs.StringVar(&o.ofs, "ofs", " ", "")
+	fs.StringVar(&o.ors, "ors", "\n", "")
+	fs.BoolVar(&o.zero, "z", false, "")
+	fs.StringVar(&o.rs, "rs", "", "")
+	fs.BoolVar(&o.paragraph, "p", false, "")
+	fs.BoolVar(&o.paragraph, "paragraph", false, "")
+	fs.Var(&o.files, "f", "")
+	fs.BoolVar(&o.filename, "with-filename", false, "")
+	fs.BoolVar(&o.lineNumber, "with-line-number", false, "")
+	fs.Var(&o.where, "where", "")
+	fs.Var(&o.cond, "if", "")
+	fs.BoolVar(&o.invert, "invert", false, "")
+
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+		if arg == "--" {
+			o.files = append(o.files, argv[i+1:]...)
+			break
+		}
+		fl := fs.Lookup(flagName(arg))
+		if fl == nil {
+			extracts = append(extracts, arg)
+			continue
+		}
+
+		args := []string{arg}
+		if bf, ok := fl.Value.(interface{ IsBoolFlag() bool }); (!ok || !bf.IsBoolFlag()) &&
+			!strings.Contains(arg, "=") && i+1 < len(argv) {
+			i++
+			args = append(args, argv[i])
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	o.set = map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { o.set[fl.Name] = true })
+	return extracts, o.validate()
+}
+
+// validate checks that options are valid and consistent with each other.
+func (o *options) validate() error {
+	if o.csv && o.tsv {
+		return errors.New("--csv and --tsv cannot be used together")
+	}
+	for _, opt := range []struct{ name, value string }{
+		{"comma", o.comma},
+		{"comment", o.comment},
+	} {
+		if opt.value != "" && utf8.RuneCountInString(opt.value) != 1 {
+			return fmt.Errorf("--%s must be a single character: %q", opt.name, opt.value)
+		}
+	}
+	if o.comma != "" && o.tsv {
+		return errors.New("--comma cannot be used with --tsv")
+	}
+	if o.fixed && o.csvInput() {
+		return errors.New("--fixed cannot be used with CSV input")
+	}
+	if (o.set["o"] || o.set["ofs"] || o.set["ors"]) && o.output != outputPlain {
+		return errors.New("--ofs and --ors can only be used with plain output")
+	}
+	if o.set["rs"] && o.rs == "" {
+		return errors.New("--rs cannot be empty")
+	}
+	if n := btoi(o.zero) + btoi(o.set["rs"]) + btoi(o.paragraph); n > 1 {
+		return errors.New("only one of -z, --rs, and --paragraph can be used")
+	} else if n == 1 && o.csvInput() {
+		return errors.New("-z, --rs, and --paragraph cannot be used with CSV input")
+	}
+	if o.paragraph && o.fixed {
+		return errors.New("--paragraph cannot be used with --fixed")
+	}
+	if o.invert && len(o.where) == 0 && len(o.cond) == 0 {
+		return errors.New("--invert requires --where or --if")
+	}
+	if o.lazyQuotes && o.tsv {
+		return errors.New("--lazy-quotes cannot be used with --tsv")
+	} else if (o.lazyQuotes || o.comment != "") && !o.csvInput() {
+		return errors.New("--lazy-quotes and --comment require --csv or --tsv")
+	}
+	return nil
+}
+
+// csvInput returns whether input is read as CSV or TSV records.
+func (o *options) csvInput() bool {
+	return o.csv || o.tsv || o.comma != ""
+}
+
+// delimiter returns the default delimiter of the first selector of each
+// extract. In paragraph mode, it's a newline, so that fields are lines.
+func (o *options) delimiter() string {
+	if o.paragraph {
+		return "\n"
+	}
+	return " "
+}
+
+// reader returns the recordReader for r described by the options.
+func (o *options) reader(r io.Reader) recordReader {
+	if o.tsv {
+		return newTSVReader(r, o.comment)
+	} else if o.csvInput() {
+		return o.csvReader(r)
+	} else if o.paragraph {
+		return newParagraphReader(r)
+	}
+
+	var rd recordReader
+	switch {
+	case o.zero:
+		rd = newSepReader(r, "\x00")
+	case o.set["rs"]:
+		rd = newSepReader(r, fex.Unescape(o.rs))
+	default:
+		rd = newLineReader(r)
+	}
+	if o.fixed {
+		rd = newFixedReader(rd)
+	}
+	return rd
+}
+
+// csvReader returns the csvReader for r described by the options.
+func (o *options) csvReader(r io.Reader) *csvReader {
+	comma := ','
+	if o.comma != "" {
+		comma, _ = utf8.DecodeRuneInString(o.comma)
+	}
+	var comment rune
+	if o.comment != "" {
+		comment, _ = utf8.DecodeRuneInString(o.comment)
+	}
+	return newCSVReader(r, comma, o.lazyQuotes, comment)
+}
+
+// writer returns the outputWriter for w described by the options. names and
+// extracts are passed to newOutputWriter.
+func (o *options) writer(w io.Writer, names, extracts []string) (outputWriter, error) {
+	if o.output == outputPlain {
+		return &plainWriter{w: w, sep: fex.Unescape(o.ofs), term: fex.Unescape(o.ors)}, nil
+	}
+	return newOutputWriter(o.output, w, names, extracts)
+}
+
+// stringList is a flag.Value holding each value a flag is set to, such as the
+// files given by -f.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// btoi returns 1 if b is true and 0 otherwise.
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// flagName returns the name of the flag in arg, which may begin with one or
+// two dashes and end with =value. If arg isn't a flag, it returns "".
+func flagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if i := strings.IndexByte(name, '='); i != -1 {
+		name = name[:i]
+	}
+	return name
+}
@@ -0,0 +1,233 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// outputWriter writes the values extracted from each record of input.
+type outputWriter interface {
+	// WriteRecord writes the values extracted from a record, one per
+	// extract.
+	WriteRecord(values []string) error
+	// Close writes anything that follows the last record. It doesn't close
+	// the underlying writer.
+	Close() error
+}
+
+// Output formats accepted by --output.
+const (
+	outputPlain = "plain"
+	outputNUL   = "nul"
+	outputCSV   = "csv"
+	outputTSV   = "tsv"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+)
+
+// newOutputWriter returns the outputWriter for format, writing to w. names
+// holds the name of each extract's column, or "" if it isn't named, and
+// extracts holds the extracts themselves, used in place of missing names.
+func newOutputWriter(format string, w io.Writer, names, extracts []string) (outputWriter, error) {
+	// Columns are only named if at least one name was given
+	var columns []string
+	for _, name := range names {
+		if name != "" {
+			columns = make([]string, len(names))
+			break
+		}
+	}
+	for i := range columns {
+		columns[i] = names[i]
+		if columns[i] == "" {
+			columns[i] = extracts[i]
+		}
+	}
+
+	switch format {
+	case outputPlain, "":
+		return &plainWriter{w: w, sep: " ", term: "\n"}, nil
+	case outputNUL:
+		// Values and records are both terminated by NUL, so only one
+		// column can be written without losing track of records.
+		if len(extracts) > 1 {
+			return nil, fmt.Errorf("%s output can only be used with one column, not %d", format, len(extracts))
+		}
+		return &plainWriter{w: w, sep: "\x00", term: "\x00"}, nil
+	case outputCSV:
+		return newCSVWriter(w, columns), nil
+	case outputTSV:
+		return newTSVWriter(w, columns), nil
+	case outputJSON, outputJSONL:
+		return &jsonWriter{w: w, keys: columns, lines: format == outputJSONL}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// plainWriter writes values separated by sep, with each record terminated by
+// term.
+type plainWriter struct {
+	w         io.Writer
+	sep, term string
+}
+
+func (pw *plainWriter) WriteRecord(values []string) error {
+	_, err := io.WriteString(pw.w, strings.Join(values, pw.sep)+pw.term)
+	return err
+}
+
+func (pw *plainWriter) Close() error {
+	return nil
+}
+
+// csvWriter writes records as CSV, preceded by a header if columns are named.
+type csvWriter struct {
+	w      *csv.Writer
+	header []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w), header: columns}
+}
+
+func (cw *csvWriter) WriteRecord(values []string) error {
+	if cw.header != nil {
+		if err := cw.w.Write(cw.header); err != nil {
+			return err
+		}
+		cw.header = nil
+	}
+	if err := cw.w.Write(values); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	return nil
+}
+
+// tsvEscaper escapes values written by tsvWriter.
+var tsvEscaper = strings.NewReplacer(
+	"\\", `\\`,
+	"\t", `\t`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+// tsvWriter writes records as tab-separated values, preceded by a header if
+// columns are named. Backslashes, tabs, and line breaks in values are escaped
+// as \\, \t, \n, and \r, so each record is a single line.
+type tsvWriter struct {
+	w      io.Writer
+	header []string
+}
+
+func newTSVWriter(w io.Writer, columns []string) *tsvWriter {
+	return &tsvWriter{w: w, header: columns}
+}
+
+func (tw *tsvWriter) WriteRecord(values []string) error {
+	if tw.header != nil {
+		header := tw.header
+		tw.header = nil
+		if err := tw.WriteRecord(header); err != nil {
+			return err
+		}
+	}
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = tsvEscaper.Replace(v)
+	}
+	_, err := io.WriteString(tw.w, strings.Join(escaped, "\t")+"\n")
+	return err
+}
+
+func (tw *tsvWriter) Close() error {
+	return nil
+}
+
+// jsonWriter writes records as JSON arrays, or as objects if columns are
+// named. If lines is true, each record is written on its own line (JSON
+// Lines). Otherwise, records are written as a single JSON array.
+type jsonWriter struct {
+	w     io.Writer
+	keys  []string
+	lines bool
+	n     int // Records written
+}
+
+func (jw *jsonWriter) WriteRecord(values []string) error {
+	var b bytes.Buffer
+	switch {
+	case jw.lines:
+	case jw.n == 0:
+		b.WriteString("[\n")
+	default:
+		b.WriteString(",\n")
+	}
+	jw.n++
+
+	start, end := byte('['), byte(']')
+	if jw.keys != nil {
+		start, end = '{', '}'
+	}
+	b.WriteByte(start)
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if jw.keys != nil {
+			writeJSONString(&b, jw.keys[i])
+			b.WriteByte(':')
+		}
+		writeJSONString(&b, v)
+	}
+	b.WriteByte(end)
+	if jw.lines {
+		b.WriteByte('\n')
+	}
+
+	_, err := jw.w.Write(b.Bytes())
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	var err error
+	switch {
+	case jw.lines:
+	case jw.n == 0:
+		_, err = io.WriteString(jw.w, "[]\n")
+	default:
+		_, err = io.WriteString(jw.w, "\n]\n")
+	}
+	return err
+}
+
+// writeJSONString writes s to b as a JSON string, without escaping HTML.
+func writeJSONString(b *bytes.Buffer, s string) {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)       // Strings can always be encoded
+	b.Truncate(b.Len() - 1) // Trailing newline
+}
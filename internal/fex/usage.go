@@ -15,7 +15,66 @@
 
 package fex
 
-const usageFormat = `Usage: %s <extract1> [extract...]
+const usageFormat = `Usage: %s [options] [name=]<extract1> [[name=]extract...] [-- file...]
+
+Options:
+
+    -H, --header     Read the first record as a header naming columns,
+                     instead of extracting fields from it.
+    --csv            Read input as CSV records instead of lines. The
+                     first selector of each extract selects columns.
+    --tsv            Read input as tab-separated values, split on every
+                     tab, with \\, \t, \n, and \r escapes and no quoting.
+    --comma C        Read CSV records separated by C instead of ','.
+    --lazy-quotes    Allow quotes in unquoted CSV fields and unescaped
+                     quotes in quoted fields.
+    --comment C      Skip CSV or TSV lines beginning with C.
+    --fixed          Read input as fixed-width columns, such as the
+                     output of ps or df, inferred from the first line
+                     and the 100 lines after it. The first selector of
+                     each extract selects columns.
+    --output FORMAT  Write output as plain (the default), nul, csv, tsv,
+                     json, or jsonl. Each extract is a column, which can
+                     be named by writing name=extract.
+    -o, --ofs SEP    Separate the values of plain output with SEP
+                     instead of a space.
+    --ors SEP        End each record of plain output with SEP instead
+                     of a newline.
+    -z               Read records terminated by NUL instead of lines.
+    --rs SEP         Read records terminated by SEP instead of lines.
+    -p, --paragraph  Read records separated by blank lines. The first
+                     selector of each extract is delimited by newlines
+                     instead of spaces, so 2 selects a record's second
+                     line.
+    -f FILE          Read FILE instead of standard input. May be given
+                     more than once. Directories are read recursively.
+    --with-filename  Write the name of each record's file before its
+                     values.
+    --with-line-number
+                     Write the number of each record in its file before
+                     its values.
+    --where COND     Only extract fields from records matching COND,
+                     which is EXTRACT==VALUE or EXTRACT=~REGEXP, split
+                     at the first == or =~. May be given more than
+                     once, in which case records must match all of them.
+    --if EXPR        Only extract fields from records for which EXPR is
+                     true, such as '$9 >= 500 && $1 ~ /^10\./'. May be
+                     given more than once.
+    --invert         Only extract fields from records not matching the
+                     --where and --if conditions.
+
+SEP may contain the escape sequences of quoted separators, such as \t
+or \z (NUL).
+
+In --if expressions, $N is the value of the extract N, and ${extract}
+is the value of any extract. Values can be compared with numbers,
+"strings", and /regexps/ using == != < <= > >= ~ !~, combined with
+&& || !, and used in arithmetic with + - * / %%. A value is compared as
+a number if it's compared with a number, and as a string otherwise.
+Two values are compared as numbers if both are numbers, as in awk.
+
+Options may be placed anywhere among the extracts. Arguments following
+-- are files to read, as with -f.
 
 Extract syntax is one or more selectors, formatted as:
 
@@ -26,16 +85,86 @@ string, unchanged.
 
 You can specify multiple fields with curly braces and numbers split by
 commas. Also valid in curly braces {} are number ranges. Number ranges
-are similar to python array slices, split by colon.
+are similar to python array slices, split by colon, and may include
+a step: {1::2} selects every other field, and {::-1} selects all fields
+in reverse.
 
 The first separator is implied as space (' '), but can be overridden.
 For example, to select the last dash-separated field, you can use --1.
 
+A separator of more than one character can be written in single quotes,
+such as '::'2. Backslashes and single quotes inside the quotes must be
+escaped with a backslash.
+
+A regexp separator is written as ~/regexp/~, such as ~/[,;]\s*/~2.
+Fields split by a regexp are joined with a space. The string used to
+join a selector's fields can be set by following it with ='string'.
+
+With -H, fields in curly braces can be named by the header, such as
+{PID,%%CPU} or {USER:COMMAND}. Names starting with a digit, sign, or '@'
+are written with an '@' prefix, as in {@1st}. Only the first selector
+of an extract can use names.
+
+Starting the inside of curly braces with '!' selects all fields except
+the ones listed, such as {!3} or {!/regexp/}.
+
+Starting the inside of curly braces with a double quote, such as {"2},
+splits fields without breaking up text in double or single quotes or
+escaped by a backslash, then removes the quotes and backslashes. With
+a single quote, such as {'2}, the quotes are kept.
+
+Curly braces prefixed with '#' select characters instead of fields,
+and braces prefixed with '%%' select bytes, such as #{1:5} or %%{-4:}.
+To split by '#' or '%%' followed by curly braces, escape it as \# or \%%.
+
 You can match fields by a regexp (regular expression) by following the
 separator with a /regexp/. If the separator is a backslash, it must be
 escaped by writing two backslashes. Forward slashes and backslashes in
 the regexp can also be escaped.
 
+A regexp can be followed by flags: i (case-insensitive), m (multi-line),
+s (let . match newlines), U (ungreedy), and ! (select fields that don't
+match). For example, /addr:/i or /tmp/!.
+
+A regexp followed by $N or $name (after any flags) selects the
+submatches of each matching field instead of the field itself, such as
+/addr:(\S+)/$1 or /(?P<k>\w+)=(?P<v>\w+)/$v,$k.
+
+s/regexp/replacement/ replaces matches of the regexp in every field
+with the replacement, which may refer to submatches as $1, ${name}, etc.
+The number of fields is unchanged. Every match is replaced, so a g flag
+is accepted but does nothing.
+
+={key,...} splits its input into key=value pairs, as in logfmt, and
+selects the values of the keys, such as ={level,dur}. Pairs are split by
+the separator before the '=' (space by default) outside of quotes, and
+a key/value separator other than '=' can follow it, as in ;=:{a,b} for
+"a:1;b:2". To split by '=' and select fields by name, escape it as \=.
+
+@.path parses its input as JSON and selects the value at the path, such
+as @.user.id or @.items[-1]. Several paths can be given in curly braces,
+as in @{.user.id,.req.path}. Strings are selected without quotes, and
+objects and arrays as JSON. JSON selectors have no separator, so the
+next selector follows them directly: @.msg:2.
+
+|name transforms the value of the selectors before it, as in 1|lower or
+2|trim([])|pad(8). Transforms are upper, lower, trim, trim(chars),
+length, pad(width), and pad(width,c), which pads on the left, or on the
+right if width is negative. Arguments can be quoted like separators.
+
+time(in,out,zone) parses a time with the layout in and formats it with
+the layout out (default rfc3339), converted to the optional time zone.
+Layouts are Go layouts, such as '2006-01-02 15:04', or apache, rfc3339,
+unix, or unixms. For example, "1[2]1|time(apache,unix) selects the time
+of an Apache log line as seconds since the Unix epoch.
+
+decode(enc) and encode(enc) decode or encode values, where enc is url,
+query (url with + for spaces), base64, base64url, hex, json (string
+escapes), or html (entities). A value that fails to transform, such as
+invalid base64, skips the record, unless the transform's last argument
+is onerror=keep, to keep the value, or onerror=empty, to empty it:
+2|decode(url,onerror=keep).
+
 Regular expressions are RE2. To use a backslash separator with a regexp
 RE2 syntax: <https://github.com/google/re2/wiki/Syntax>.
 
@@ -50,6 +179,9 @@ Some examples:
     {1:3}      Output tokens 1 through 3.
                'foo bar baz fizz' by '{1:3}' outputs 'foo bar baz'.
 
+    '::'2      Output the second token split by '::'.
+               'foo::bar:baz' by "'::'2" outputs 'bar:baz'.
+
     :/home/    First split by ':' and yield only fields matching the
                regexp /home/.
 
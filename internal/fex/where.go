@@ -0,0 +1,65 @@
+// Copyright 2007-2011 Jordan Sissel
+// Copyright 2018 Noel Cower (Go implementation)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fex
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// predicate is a condition that records must match to be written, given by
+// --where or --if. Its extracts are compiled and resolved with the other
+// extracts of fex, and their values are passed to match.
+type predicate interface {
+	extracts() []string
+	match(values []string) bool
+}
+
+// condition is a condition given by --where. A record matches it if the value
+// of its extract is equal to value or, if rx is not nil, matches rx.
+type condition struct {
+	extract string
+	value   string
+	rx      *regexp.Regexp
+}
+
+// parseCondition parses a condition of the form EXTRACT==VALUE or
+// EXTRACT=~REGEXP, split at the first == or =~ in arg.
+func parseCondition(arg string) (*condition, error) {
+	i := strings.Index(arg, "==")
+	if j := strings.Index(arg, "=~"); j != -1 && (i == -1 || j < i) {
+		rx, err := regexp.Compile(arg[j+2:])
+		if err != nil {
+			return nil, err
+		}
+		return &condition{extract: arg[:j], rx: rx}, nil
+	} else if i == -1 {
+		return nil, errors.New("missing == or =~")
+	}
+	return &condition{extract: arg[:i], value: arg[i+2:]}, nil
+}
+
+func (c *condition) extracts() []string {
+	return []string{c.extract}
+}
+
+func (c *condition) match(values []string) bool {
+	if c.rx != nil {
+		return c.rx.MatchString(values[0])
+	}
+	return values[0] == c.value
+}